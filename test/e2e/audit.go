@@ -1,17 +1,22 @@
 package e2e
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/authz"
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/clusterconfig"
 	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/utils"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
 	auditinternal "k8s.io/apiserver/pkg/apis/audit"
 	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	restclient "k8s.io/client-go/rest"
 	"k8s.io/kubernetes/test/e2e/framework"
 	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
 
@@ -32,6 +37,10 @@ var _ = framework.KubeDescribe("Audit", func() {
 	})
 
 	It("Should audit API calls to create, update, patch, delete pods. [Audit] [Zalando]", func() {
+		// the tailers start at the end of the log, so only the events of the
+		// spec are checked, whatever the clock skew with the API server
+		eventsLog := newAuditLogTailer()
+		assertionsLog := newAuditLogTailer()
 		pod := &apiv1.Pod{
 			ObjectMeta: metav1.ObjectMeta{
 				Name: "audit-pod",
@@ -45,18 +54,30 @@ var _ = framework.KubeDescribe("Audit", func() {
 		}
 		updatePod := func(pod *apiv1.Pod) {}
 
+		// the expected levels are the ones of the audit policy of the masters
+		auditPolicy, err := clusterconfig.LoadClusterAuditPolicy(E2EClusterDir(), clusterconfig.AuditPolicyFile, clusterconfig.E2EClusterConfig())
+		framework.ExpectNoError(err, "failed to load the audit policy")
+		podRequestLevel := func(verb string) auditinternal.Level {
+			return auditPolicy.Evaluate(authz.Attributes{
+				User:      auditTestUser,
+				Verb:      verb,
+				Resource:  "pods",
+				Namespace: namespace,
+			}.AuthorizerAttributes()).Level
+		}
+
 		f.PodClient().CreateSync(pod)
 
 		f.PodClient().Update(pod.Name, updatePod)
 
-		_, err := f.PodClient().Patch(pod.Name, types.JSONPatchType, patch)
+		_, err = f.PodClient().Patch(pod.Name, types.JSONPatchType, patch)
 		framework.ExpectNoError(err, "failed to patch pod")
 
 		f.PodClient().DeleteSync(pod.Name, &metav1.DeleteOptions{}, framework.DefaultPodDeletionTimeout)
 
-		expectEvents(f, []utils.AuditEvent{
+		expectEvents(eventsLog, []utils.AuditEvent{
 			{
-				Level:             auditinternal.LevelRequest,
+				Level:             podRequestLevel("create"),
 				Stage:             auditinternal.StageResponseComplete,
 				RequestURI:        fmt.Sprintf("/api/v1/namespaces/%s/pods", namespace),
 				Verb:              "create",
@@ -67,7 +88,7 @@ var _ = framework.KubeDescribe("Audit", func() {
 				RequestObject:     true,
 				AuthorizeDecision: "allow",
 			}, {
-				Level:             auditinternal.LevelRequest,
+				Level:             podRequestLevel("update"),
 				Stage:             auditinternal.StageResponseComplete,
 				RequestURI:        fmt.Sprintf("/api/v1/namespaces/%s/pods/audit-pod", namespace),
 				Verb:              "update",
@@ -78,7 +99,7 @@ var _ = framework.KubeDescribe("Audit", func() {
 				RequestObject:     true,
 				AuthorizeDecision: "allow",
 			}, {
-				Level:             auditinternal.LevelRequest,
+				Level:             podRequestLevel("patch"),
 				Stage:             auditinternal.StageResponseComplete,
 				RequestURI:        fmt.Sprintf("/api/v1/namespaces/%s/pods/audit-pod", namespace),
 				Verb:              "patch",
@@ -89,7 +110,7 @@ var _ = framework.KubeDescribe("Audit", func() {
 				RequestObject:     true,
 				AuthorizeDecision: "allow",
 			}, {
-				Level:             auditinternal.LevelRequest,
+				Level:             podRequestLevel("delete"),
 				Stage:             auditinternal.StageResponseComplete,
 				RequestURI:        fmt.Sprintf("/api/v1/namespaces/%s/pods/audit-pod", namespace),
 				Verb:              "delete",
@@ -101,28 +122,86 @@ var _ = framework.KubeDescribe("Audit", func() {
 				AuthorizeDecision: "allow",
 			},
 		})
+
+		podRequest := func(verb string) utils.AuditExpectation {
+			return utils.AuditEventMatcher{
+				Stage:     utils.Equals(string(auditinternal.StageResponseComplete)),
+				Verb:      utils.Equals(verb),
+				User:      utils.Equals(auditTestUser),
+				Resource:  utils.Equals("pods"),
+				Namespace: utils.Equals(namespace),
+			}
+		}
+
+		expectAuditAssertions(assertionsLog, utils.AuditAssertions{
+			Sequences: []utils.AuditSequence{{
+				Events: []utils.AuditExpectation{
+					podRequest("create"),
+					podRequest("update"),
+					podRequest("patch"),
+					podRequest("delete"),
+				},
+			}},
+			Forbidden: []utils.AuditExpectation{
+				utils.AuditEventMatcher{
+					Verb:      utils.Equals("get"),
+					User:      utils.Equals(auditTestUser),
+					Resource:  utils.Equals("secrets"),
+					Namespace: utils.Equals(namespace),
+				},
+			},
+		})
 	})
 })
 
-func expectEvents(f *framework.Framework, expectedEvents []utils.AuditEvent) {
-	// The default flush timeout is 30 seconds, therefore it should be enough to retry once
-	// to find all expected events. However, we're waiting for 5 minutes to avoid flakes.
-	pollingInterval := 30 * time.Second
+// newAuditLogTailer returns a tailer of the audit log of the API server,
+// which skips the events logged so far.
+func newAuditLogTailer() *utils.AuditLogTailer {
+	config, err := framework.LoadConfig()
+	framework.ExpectNoError(err, "failed to load the client config")
+
+	transport, err := restclient.TransportFor(config)
+	framework.ExpectNoError(err, "failed to create the audit log transport")
+
+	tailer := utils.NewAuditLogTailer(
+		&http.Client{Transport: transport},
+		strings.TrimSuffix(config.Host, "/")+"/logs/kube-audit.log",
+		auditv1.SchemeGroupVersion,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	framework.ExpectNoError(tailer.SeekToEnd(ctx), "failed to read the audit log")
+	return tailer
+}
+
+func expectEvents(auditLog *utils.AuditLogTailer, expectedEvents []utils.AuditEvent) {
+	// The default flush timeout is 30 seconds, only the new part of the log
+	// is fetched on every poll. We're waiting for 5 minutes to avoid flakes.
+	pollingInterval := 10 * time.Second
 	pollingTimeout := 5 * time.Minute
-	err := wait.Poll(pollingInterval, pollingTimeout, func() (bool, error) {
-		// Fetch the log stream.
-		stream, err := f.ClientSet.CoreV1().RESTClient().Get().AbsPath("/logs/kube-audit.log").Stream()
-		if err != nil {
-			return false, err
-		}
-		defer stream.Close()
-		missingReport, err := utils.CheckAuditLines(stream, expectedEvents, auditv1.SchemeGroupVersion)
-		if err != nil {
-			e2elog.Logf("Failed to observe audit events: %v", err)
-		} else if len(missingReport.MissingEvents) > 0 {
-			e2elog.Logf("Events %#v not found!", missingReport)
-		}
-		return len(missingReport.MissingEvents) == 0, nil
-	})
+	ctx, cancel := context.WithTimeout(context.Background(), pollingTimeout)
+	defer cancel()
+	missingReport, err := auditLog.WaitForEvents(ctx, utils.AuditEvents(expectedEvents...), pollingInterval)
+	if len(missingReport.MissingEvents) > 0 {
+		e2elog.Logf("Events not found: %s", missingReport)
+	}
 	framework.ExpectNoError(err, "after %v failed to observe audit events", pollingTimeout)
 }
+
+// expectAuditAssertions waits for the sequences of the assertions to show up
+// in the audit log, and fails as soon as a forbidden event shows up.
+func expectAuditAssertions(auditLog *utils.AuditLogTailer, assertions utils.AuditAssertions) {
+	pollingInterval := 10 * time.Second
+	pollingTimeout := 5 * time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), pollingTimeout)
+	defer cancel()
+	report, err := auditLog.WaitForAssertions(ctx, assertions, pollingInterval)
+	if len(report.ForbiddenEvents) > 0 {
+		framework.Failf("forbidden audit events found: %s", report)
+	}
+	if len(report.Incomplete()) > 0 {
+		e2elog.Logf("Audit sequences not found: %s", report)
+	}
+	framework.ExpectNoError(err, "after %v failed to observe the audit sequences", pollingTimeout)
+}
@@ -0,0 +1,137 @@
+package e2e
+
+import (
+	"context"
+	"time"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+
+	. "github.com/onsi/ginkgo"
+)
+
+var platformCredentialsSetResource = schema.GroupVersionResource{
+	Group:    "zalando.org",
+	Version:  "v1",
+	Resource: "platformcredentialssets",
+}
+
+var _ = framework.KubeDescribe("Audit redaction", func() {
+	f := framework.NewDefaultFramework("audit-redaction")
+
+	It("Should only log the metadata of secrets [Audit] [Zalando]", func() {
+		namespace := f.Namespace.Name
+		auditLog := newAuditLogTailer()
+
+		var expectedEvents []utils.AuditExpectation
+		secrets := f.ClientSet.CoreV1().Secrets(namespace)
+		for _, secret := range []*v1.Secret{{
+			ObjectMeta: metav1.ObjectMeta{Name: "audit-redaction-secret"},
+			StringData: map[string]string{"password": "audit-redaction-secret"},
+		}, {
+			// the layout of the secrets of kube-aws-iam-controller
+			ObjectMeta: metav1.ObjectMeta{Name: "audit-redaction-aws-iam"},
+			StringData: map[string]string{
+				"credentials":         "[default]\naws_access_key_id = AKIAREDACTIONTEST\naws_secret_access_key = audit-redaction-secret\n",
+				"credentials.process": `{"Version": 1, "AccessKeyId": "AKIAREDACTIONTEST", "SecretAccessKey": "audit-redaction-secret"}`,
+			},
+		}} {
+			By("Creating, reading and updating the secret " + secret.Name)
+			_, err := secrets.Create(secret)
+			framework.ExpectNoError(err, "failed to create the secret")
+
+			created, err := secrets.Get(secret.Name, metav1.GetOptions{})
+			framework.ExpectNoError(err, "failed to get the secret")
+
+			created.StringData = map[string]string{"password": "audit-redaction-updated"}
+			_, err = secrets.Update(created)
+			framework.ExpectNoError(err, "failed to update the secret")
+
+			expectedEvents = append(expectedEvents, redactionRequests(namespace, "", "secrets", secret.Name)...)
+		}
+
+		expectRedactedAuditEvents(auditLog, expectedEvents)
+	})
+
+	// pending until the audit policy of the masters logs the platform
+	// credentials sets at the Metadata level, TestSecretsAuditLevel reports
+	// the gap meanwhile
+	PIt("Should only log the metadata of platform credentials sets [Audit] [Zalando]", func() {
+		namespace := f.Namespace.Name
+		auditLog := newAuditLogTailer()
+
+		By("Creating, reading and updating a platform credentials set")
+		credentialsSets := f.DynamicClient.Resource(platformCredentialsSetResource).Namespace(namespace)
+		pcs := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "zalando.org/v1",
+			"kind":       "PlatformCredentialsSet",
+			"metadata": map[string]interface{}{
+				"name": "audit-redaction-pcs",
+			},
+			"spec": map[string]interface{}{
+				"application": "audit-redaction-test",
+				"tokens": map[string]interface{}{
+					"test": map[string]interface{}{
+						"privileges": []interface{}{},
+					},
+				},
+			},
+		}}
+
+		_, err := credentialsSets.Create(pcs, metav1.CreateOptions{})
+		framework.ExpectNoError(err, "failed to create the platform credentials set")
+
+		created, err := credentialsSets.Get(pcs.GetName(), metav1.GetOptions{})
+		framework.ExpectNoError(err, "failed to get the platform credentials set")
+
+		created.SetLabels(map[string]string{"audit-redaction": "updated"})
+		_, err = credentialsSets.Update(created, metav1.UpdateOptions{})
+		framework.ExpectNoError(err, "failed to update the platform credentials set")
+
+		expectRedactedAuditEvents(auditLog, redactionRequests(namespace, platformCredentialsSetResource.Group, platformCredentialsSetResource.Resource, pcs.GetName()))
+	})
+})
+
+// redactionRequests returns the expected events of the creation, the read and
+// the update of an object.
+func redactionRequests(namespace, apiGroup, resource, name string) []utils.AuditExpectation {
+	var events []utils.AuditExpectation
+	for _, verb := range []string{"create", "get", "update"} {
+		events = append(events, utils.AuditEventMatcher{
+			Stage:     utils.Equals(string(auditinternal.StageResponseComplete)),
+			Verb:      utils.Equals(verb),
+			APIGroup:  utils.Equals(apiGroup),
+			Resource:  utils.Equals(resource),
+			Namespace: utils.Equals(namespace),
+			Name:      utils.Equals(name),
+		})
+	}
+
+	return events
+}
+
+// expectRedactedAuditEvents waits for the expected events, and fails if any
+// event of a sensitive resource is logged with more than its metadata.
+func expectRedactedAuditEvents(auditLog *utils.AuditLogTailer, expectedEvents []utils.AuditExpectation) {
+	By("Checking the audit events of the sensitive resources")
+	pollingTimeout := 5 * time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), pollingTimeout)
+	defer cancel()
+
+	redaction := utils.NewAuditRedactionChecker(utils.SensitiveResources)
+	missingReport, err := auditLog.WaitForEvents(ctx, expectedEvents, 10*time.Second, redaction.Check)
+	if len(missingReport.MissingEvents) > 0 {
+		e2elog.Logf("Events not found: %s", missingReport)
+	}
+	framework.ExpectNoError(err, "after %v failed to observe audit events", pollingTimeout)
+
+	report := redaction.Report()
+	e2elog.Logf("Audit redaction: %s", report)
+	framework.ExpectNoError(report.Err())
+}
@@ -0,0 +1,234 @@
+package e2e
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/authz"
+)
+
+func TestImpersonatedRequest(t *testing.T) {
+	resources := map[string]resourceInfo{
+		"/pods":            {groupVersion: "v1", kind: "Pod", namespaced: true},
+		"/nodes":           {groupVersion: "v1", kind: "Node"},
+		"apps/deployments": {groupVersion: "apps/v1", kind: "Deployment", namespaced: true},
+	}
+
+	request := func(verb, resource string) authz.RequestData {
+		return authz.RequestData{
+			Users:      []string{"test-user"},
+			Groups:     [][]string{{"ReadOnly", "system:authenticated"}},
+			Namespaces: []string{"default"},
+			Verbs:      []string{verb},
+			Resources:  []string{resource},
+		}
+	}
+
+	impersonation := map[string][]string{
+		"Authorization":     {"Bearer t0ken"},
+		"Impersonate-User":  {"test-user"},
+		"Impersonate-Group": {"ReadOnly", "system:authenticated"},
+	}
+
+	with := func(headers map[string][]string, extra ...string) map[string][]string {
+		result := make(map[string][]string)
+		for k, v := range headers {
+			result[k] = v
+		}
+
+		for i := 0; i < len(extra); i += 2 {
+			result[extra[i]] = []string{extra[i+1]}
+		}
+
+		return result
+	}
+
+	for _, test := range []struct {
+		name    string
+		request func(r *authz.RequestData)
+		review  string
+		method  string
+		url     string
+		headers map[string][]string
+		skipped bool
+	}{{
+		name: "get by name",
+		request: func(r *authz.RequestData) {
+			*r = request("get", "pods")
+			r.Names = []string{"foo"}
+		},
+		method:  http.MethodGet,
+		url:     "https://api.example.org/api/v1/namespaces/default/pods/foo",
+		headers: impersonation,
+	}, {
+		name:    "get without name",
+		request: func(r *authz.RequestData) { *r = request("get", "pods") },
+		method:  http.MethodGet,
+		url:     "https://api.example.org/api/v1/namespaces/default/pods/" + placeholderName,
+		headers: impersonation,
+	}, {
+		name:    "list of an API group",
+		request: func(r *authz.RequestData) { *r = request("list", "apps/deployments") },
+		method:  http.MethodGet,
+		url:     "https://api.example.org/apis/apps/v1/namespaces/default/deployments",
+		headers: impersonation,
+	}, {
+		name:    "watch",
+		request: func(r *authz.RequestData) { *r = request("watch", "pods") },
+		method:  http.MethodGet,
+		url:     "https://api.example.org/api/v1/namespaces/default/pods?timeoutSeconds=1&watch=true",
+		headers: impersonation,
+	}, {
+		name:    "create with dry-run",
+		request: func(r *authz.RequestData) { *r = request("create", "pods") },
+		method:  http.MethodPost,
+		url:     "https://api.example.org/api/v1/namespaces/default/pods?dryRun=All",
+		headers: with(impersonation, "Content-Type", "application/json"),
+	}, {
+		name: "create of a subresource",
+		request: func(r *authz.RequestData) {
+			*r = request("create", "pods")
+			r.Subresources = []string{"eviction"}
+		},
+		method:  http.MethodPost,
+		url:     "https://api.example.org/api/v1/namespaces/default/pods/" + placeholderName + "/eviction?dryRun=All",
+		headers: with(impersonation, "Content-Type", "application/json"),
+	}, {
+		name:    "patch with dry-run",
+		request: func(r *authz.RequestData) { *r = request("patch", "apps/deployments") },
+		method:  http.MethodPatch,
+		url:     "https://api.example.org/apis/apps/v1/namespaces/default/deployments/" + placeholderName + "?dryRun=All",
+		headers: with(impersonation, "Content-Type", "application/merge-patch+json"),
+	}, {
+		name:    "deletecollection with dry-run",
+		request: func(r *authz.RequestData) { *r = request("deletecollection", "pods") },
+		method:  http.MethodDelete,
+		url:     "https://api.example.org/api/v1/namespaces/default/pods?dryRun=All",
+		headers: impersonation,
+	}, {
+		name: "cluster scoped resource",
+		request: func(r *authz.RequestData) {
+			*r = request("delete", "nodes")
+			r.Namespaces = nil
+		},
+		method:  http.MethodDelete,
+		url:     "https://api.example.org/api/v1/nodes/" + placeholderName + "?dryRun=All",
+		headers: impersonation,
+	}, {
+		name: "non resource path",
+		request: func(r *authz.RequestData) {
+			*r = authz.RequestData{
+				Users:            []string{"test-user"},
+				NonResourceVerbs: []string{"get"},
+				NonResourcePaths: []string{"/healthz"},
+			}
+		},
+		method: http.MethodGet,
+		url:    "https://api.example.org/healthz",
+		headers: map[string][]string{
+			"Impersonate-User":  {"test-user"},
+			"Impersonate-Group": nil,
+		},
+	}, {
+		name: "extra with an escaped key",
+		request: func(r *authz.RequestData) {
+			*r = request("get", "pods")
+			r.Extra = []map[string][]string{{"example.org/scopes": {"read", "write"}}}
+		},
+		method: http.MethodGet,
+		url:    "https://api.example.org/api/v1/namespaces/default/pods/" + placeholderName,
+		headers: map[string][]string{
+			"Impersonate-User":                       {"test-user"},
+			"Impersonate-Extra-Example.org%2fscopes": {"read", "write"},
+			"Impersonate-Extra-Example.org/scopes":   nil,
+		},
+	}, {
+		name:    "self review",
+		request: func(r *authz.RequestData) { *r = request("get", "pods") },
+		review:  authz.SelfSubjectAccessReview,
+		method:  http.MethodGet,
+		url:     "https://api.example.org/api/v1/namespaces/default/pods/" + placeholderName,
+		headers: map[string][]string{
+			"Authorization":     {"Bearer t0ken"},
+			"Impersonate-User":  nil,
+			"Impersonate-Group": nil,
+		},
+	}, {
+		name:    "unknown resource",
+		request: func(r *authz.RequestData) { *r = request("get", "secrets") },
+		skipped: true,
+	}, {
+		name:    "namespaced request of a cluster scoped resource",
+		request: func(r *authz.RequestData) { *r = request("get", "nodes") },
+		skipped: true,
+	}, {
+		name: "connect subresource of an existing object",
+		request: func(r *authz.RequestData) {
+			*r = request("create", "pods")
+			r.Names = []string{"foo"}
+			r.Subresources = []string{"exec"}
+		},
+		skipped: true,
+	}, {
+		name:    "verb without a request",
+		request: func(r *authz.RequestData) { *r = request("escalate", "pods") },
+		skipped: true,
+	}, {
+		name: "non resource verb other than get",
+		request: func(r *authz.RequestData) {
+			*r = authz.RequestData{
+				Users:            []string{"test-user"},
+				NonResourceVerbs: []string{"post"},
+				NonResourcePaths: []string{"/healthz"},
+			}
+		},
+		skipped: true,
+	}, {
+		name: "uid",
+		request: func(r *authz.RequestData) {
+			*r = request("get", "pods")
+			r.UIDs = []string{"42"}
+		},
+		skipped: true,
+	}, {
+		name: "no user",
+		request: func(r *authz.RequestData) {
+			*r = request("get", "pods")
+			r.Users = nil
+		},
+		skipped: true,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			item := authz.TestItem{Name: test.name, Review: test.review}
+			test.request(&item.Request)
+
+			req, err := impersonatedRequest("https://api.example.org", "t0ken", resources, item)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.skipped {
+				if req != nil {
+					t.Fatalf("expected the case to be skipped, got %s %s", req.Method, req.URL)
+				}
+
+				return
+			}
+
+			if req == nil {
+				t.Fatal("unexpected skipped case")
+			}
+
+			if req.Method != test.method || req.URL.String() != test.url {
+				t.Errorf("expected %s %s, got %s %s", test.method, test.url, req.Method, req.URL)
+			}
+
+			for k, v := range test.headers {
+				if !reflect.DeepEqual(req.Header[k], v) {
+					t.Errorf("expected header %s %v, got %v", k, v, req.Header[k])
+				}
+			}
+		})
+	}
+}
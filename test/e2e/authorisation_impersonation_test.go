@@ -0,0 +1,323 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/authz"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	restclient "k8s.io/client-go/rest"
+)
+
+// placeholderName is the name used for the objects in the impersonated
+// requests of test cases without a name. The object doesn't exist, so an
+// authorized request fails with not found instead of touching anything.
+const placeholderName = "authorization-e2e-nonexistent"
+
+// connectSubresources are executed even with dry-run, so they're only sent
+// for the placeholder name.
+var connectSubresources = map[string]bool{
+	"attach":      true,
+	"exec":        true,
+	"portforward": true,
+	"proxy":       true,
+}
+
+type resourceInfo struct {
+	groupVersion string
+	kind         string
+	namespaced   bool
+}
+
+// discoverResources returns the preferred version of the resources served by
+// the cluster, by group/resource.
+func discoverResources(conf *restclient.Config) (map[string]resourceInfo, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := client.ServerPreferredResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, err
+	}
+
+	resources := make(map[string]resourceInfo)
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, r := range list.APIResources {
+			resources[gv.Group+"/"+r.Name] = resourceInfo{
+				groupVersion: list.GroupVersion,
+				kind:         r.Kind,
+				namespaced:   r.Namespaced,
+			}
+		}
+	}
+
+	return resources, nil
+}
+
+func apiResources(resources map[string]resourceInfo) []authz.APIResource {
+	var result []authz.APIResource
+	for key, info := range resources {
+		groupResource := strings.SplitN(key, "/", 2)
+		result = append(result, authz.APIResource{
+			Group:      groupResource[0],
+			Resource:   groupResource[1],
+			Namespaced: info.namespaced,
+		})
+	}
+
+	return result
+}
+
+// impersonatedRequest builds the real request of a test case, impersonating
+// the user of the case. It returns nil when the case can't be sent as a real
+// request.
+func impersonatedRequest(host, token string, resources map[string]resourceInfo, test authz.TestItem) (*http.Request, error) {
+	attr := test.Attributes()
+	var (
+		method string
+		p      string
+		query  = url.Values{}
+		body   []byte
+	)
+
+	if attr.NonResource {
+		if attr.Verb != "get" {
+			return nil, nil
+		}
+
+		method, p = http.MethodGet, attr.Path
+	} else {
+		info, ok := resources[attr.APIGroup+"/"+attr.Resource]
+		if !ok || !info.namespaced && attr.Namespace != "" {
+			return nil, nil
+		}
+
+		name := attr.Name
+		if name == "" {
+			name = placeholderName
+		} else if connectSubresources[attr.Subresource] {
+			return nil, nil
+		}
+
+		p = "/apis/" + info.groupVersion
+		if info.groupVersion == "v1" {
+			p = "/api/v1"
+		}
+
+		if attr.Namespace != "" {
+			p += "/namespaces/" + attr.Namespace
+		}
+
+		p += "/" + attr.Resource
+		collection := p
+		item := p + "/" + name
+		if attr.Subresource != "" {
+			item += "/" + attr.Subresource
+		}
+
+		object, err := json.Marshal(map[string]interface{}{
+			"apiVersion": info.groupVersion,
+			"kind":       info.kind,
+			"metadata":   map[string]string{"name": name, "namespace": attr.Namespace},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch attr.Verb {
+		case "get":
+			method, p = http.MethodGet, item
+		case "list":
+			method, p = http.MethodGet, collection
+		case "watch":
+			method, p = http.MethodGet, collection
+			query.Set("watch", "true")
+			query.Set("timeoutSeconds", "1")
+		case "create":
+			method, p, body = http.MethodPost, collection, object
+			if attr.Subresource != "" {
+				p = item
+			}
+		case "update":
+			method, p, body = http.MethodPut, item, object
+		case "patch":
+			method, p, body = http.MethodPatch, item, []byte("{}")
+		case "delete":
+			method, p = http.MethodDelete, item
+		case "deletecollection":
+			method, p = http.MethodDelete, collection
+		default:
+			return nil, nil
+		}
+
+		if method != http.MethodGet {
+			query.Set("dryRun", "All")
+		}
+	}
+
+	u := host + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	switch method {
+	case http.MethodPatch:
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	case http.MethodPost, http.MethodPut:
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// self reviews check the permissions of the test user itself
+	if test.Review == authz.SelfSubjectAccessReview {
+		return req, nil
+	}
+
+	// groups can only be impersonated together with a user, and the uid
+	// can't be impersonated
+	if attr.User == "" || attr.UID != "" {
+		return nil, nil
+	}
+
+	req.Header.Set("Impersonate-User", attr.User)
+	for _, g := range attr.Groups {
+		req.Header.Add("Impersonate-Group", g)
+	}
+
+	for k, values := range attr.Extra {
+		for _, v := range values {
+			req.Header.Add("Impersonate-Extra-"+url.PathEscape(k), v)
+		}
+	}
+
+	return req, nil
+}
+
+// impersonationFailure is a test case where the result of the real request
+// diverges from the expectation of the access review.
+type impersonationFailure struct {
+	test   authz.TestItem
+	method string
+	url    string
+	status string
+	reason string
+	err    error
+}
+
+func (f impersonationFailure) String() string {
+	if f.err != nil {
+		return fmt.Sprintf("%s: %v", f.test, f.err)
+	}
+
+	expected := "forbidden"
+	if f.test.Expect.Allowed {
+		expected = "not forbidden"
+	}
+
+	failure := fmt.Sprintf("%s: %s %s returned %s, expected %s", f.test, f.method, f.url, f.status, expected)
+	if f.reason != "" {
+		failure += "\n    reason: " + f.reason
+	}
+
+	return failure
+}
+
+// statusReason returns the reason of the Status returned with an error
+// response. The body of a successful response may contain the objects the
+// user has access to, so it's never read.
+func statusReason(rsp *http.Response) string {
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return ""
+	}
+
+	var status metav1.Status
+	if err := json.NewDecoder(io.LimitReader(rsp.Body, 64*1024)).Decode(&status); err != nil {
+		return ""
+	}
+
+	if status.Message == "" {
+		return string(status.Reason)
+	}
+
+	return fmt.Sprintf("%s: %s", status.Reason, status.Message)
+}
+
+func runImpersonatedRequest(client *http.Client, req *http.Request, test authz.TestItem) *impersonationFailure {
+	rsp, err := client.Do(req)
+	if err != nil {
+		return &impersonationFailure{test: test, err: err}
+	}
+
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusUnauthorized ||
+		(rsp.StatusCode == http.StatusForbidden) == test.Expect.Allowed {
+		return &impersonationFailure{
+			test:   test,
+			method: req.Method,
+			url:    req.URL.String(),
+			status: rsp.Status,
+			reason: statusReason(rsp),
+		}
+	}
+
+	return nil
+}
+
+// runImpersonated sends the test cases as real requests, with at most
+// concurrency requests in flight. It returns the cases where the result
+// diverges from the access review expectation, and the number of cases
+// that can't be sent as real requests.
+func runImpersonated(client *http.Client, host, token string, resources map[string]resourceInfo, tests []authz.TestItem, concurrency int) ([]impersonationFailure, int) {
+	results := make([]*impersonationFailure, len(tests))
+	skipped := make([]bool, len(tests))
+	runConcurrently(len(tests), concurrency, func(i int) {
+		req, err := impersonatedRequest(host, token, resources, tests[i])
+		switch {
+		case err != nil:
+			results[i] = &impersonationFailure{test: tests[i], err: err}
+		case req == nil:
+			skipped[i] = true
+		default:
+			results[i] = runImpersonatedRequest(client, req, tests[i])
+		}
+	})
+
+	var (
+		failures     []impersonationFailure
+		skippedCount int
+	)
+
+	for i, f := range results {
+		if skipped[i] {
+			skippedCount++
+		}
+
+		if f != nil {
+			failures = append(failures, *f)
+		}
+	}
+
+	return failures, skippedCount
+}
@@ -0,0 +1,76 @@
+package authz
+
+import (
+	"strings"
+)
+
+// Attributes are the attributes of a single access review, as derived from
+// an expanded test item.
+type Attributes struct {
+	User   string
+	UID    string
+	Groups []string
+	Extra  map[string][]string
+
+	// NonResource is set for requests to non resource paths, in which case
+	// only Verb and Path are used.
+	NonResource bool
+	Verb        string
+	Path        string
+
+	Namespace   string
+	Name        string
+	APIGroup    string
+	Resource    string
+	Subresource string
+}
+
+// Attributes returns the access review attributes of an expanded test item.
+func (item TestItem) Attributes() Attributes {
+	var attr Attributes
+
+	// taking the first value if exists, because at this point the test item should be
+	// already expanded
+	setIfExists := func(field *string, values []string) {
+		if len(values) > 0 {
+			*field = values[0]
+		}
+	}
+
+	if len(item.Request.NonResourceVerbs) > 0 || len(item.Request.NonResourcePaths) > 0 {
+		attr.NonResource = true
+		setIfExists(&attr.Verb, item.Request.NonResourceVerbs)
+		setIfExists(&attr.Path, item.Request.NonResourcePaths)
+	} else {
+		setIfExists(&attr.Namespace, item.Request.Namespaces)
+		setIfExists(&attr.Name, item.Request.Names)
+		setIfExists(&attr.Verb, item.Request.Verbs)
+		setIfExists(&attr.APIGroup, item.Request.APIGroups)
+		setIfExists(&attr.Resource, item.Request.Resources)
+		setIfExists(&attr.Subresource, item.Request.Subresources)
+		setIfExists(&attr.Path, item.Request.Paths)
+
+		parts := strings.Split(attr.Resource, "/")
+		switch {
+		case len(parts) == 2:
+			attr.APIGroup = parts[0]
+			attr.Resource = parts[1]
+		case len(parts) == 3:
+			attr.APIGroup = parts[0]
+			attr.Resource = parts[1]
+			attr.Subresource = parts[2]
+		}
+	}
+
+	setIfExists(&attr.User, item.Request.Users)
+	setIfExists(&attr.UID, item.Request.UIDs)
+	if len(item.Request.Groups) > 0 {
+		attr.Groups = item.Request.Groups[0]
+	}
+
+	if len(item.Request.Extra) > 0 {
+		attr.Extra = item.Request.Extra[0]
+	}
+
+	return attr
+}
@@ -0,0 +1,348 @@
+package authz
+
+import (
+	"fmt"
+	"sort"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/kubernetes/plugin/pkg/auth/authorizer/rbac"
+)
+
+// Grant is a rule that allowed a test case, together with the role and the
+// binding it came from.
+type Grant struct {
+	Binding string `json:"binding"`
+	Role    string `json:"role"`
+	Rule    int    `json:"rule"`
+}
+
+// CaseCoverage lists the rules allowing an expanded test case. Cases not
+// allowed by RBAC have no grants, because RBAC has no deny rules.
+type CaseCoverage struct {
+	Name      string  `json:"name"`
+	Source    string  `json:"source"`
+	Skipped   bool    `json:"skipped,omitempty"`
+	GrantedBy []Grant `json:"grantedBy,omitempty"`
+}
+
+// RuleRef identifies a rule of a role.
+type RuleRef struct {
+	Role  string            `json:"role"`
+	Index int               `json:"index"`
+	Rule  rbacv1.PolicyRule `json:"rule"`
+}
+
+// CoverageReport tells which rules, roles and bindings are exercised by the
+// authorization matrix.
+type CoverageReport struct {
+	Rules             int            `json:"rules"`
+	CoveredRules      int            `json:"coveredRules"`
+	Percentage        float64        `json:"percentage"`
+	UncoveredRules    []RuleRef      `json:"uncoveredRules"`
+	UncoveredRoles    []string       `json:"uncoveredRoles"`
+	UncoveredBindings []string       `json:"uncoveredBindings"`
+	UntestedSubjects  []string       `json:"untestedSubjects"`
+	Cases             []CaseCoverage `json:"cases"`
+}
+
+func clusterRoleName(name string) string {
+	return "ClusterRole/" + name
+}
+
+func roleName(namespace, name string) string {
+	return fmt.Sprintf("Role/%s/%s", namespace, name)
+}
+
+func clusterRoleBindingName(b *rbacv1.ClusterRoleBinding) string {
+	return "ClusterRoleBinding/" + b.Name
+}
+
+func roleBindingName(b *rbacv1.RoleBinding) string {
+	return fmt.Sprintf("RoleBinding/%s/%s", b.Namespace, b.Name)
+}
+
+func subjectName(s rbacv1.Subject) string {
+	if s.Kind == rbacv1.ServiceAccountKind {
+		return fmt.Sprintf("%s/%s/%s", s.Kind, s.Namespace, s.Name)
+	}
+
+	return fmt.Sprintf("%s/%s", s.Kind, s.Name)
+}
+
+// appliesTo tells whether a binding subject matches a user, the same way as
+// the RBAC authorizer does. The namespace is the one of the binding, used
+// for service accounts without a namespace.
+func appliesTo(u user.Info, s rbacv1.Subject, namespace string) bool {
+	switch s.Kind {
+	case rbacv1.UserKind:
+		return u.GetName() == s.Name
+	case rbacv1.GroupKind:
+		return contains(u.GetGroups(), s.Name)
+	case rbacv1.ServiceAccountKind:
+		saNamespace := s.Namespace
+		if saNamespace == "" {
+			saNamespace = namespace
+		}
+
+		return saNamespace != "" && u.GetName() == serviceaccount.MakeUsername(saNamespace, s.Name)
+	default:
+		return false
+	}
+}
+
+// sourcedRule is a rule together with the role defining it. For aggregated
+// cluster roles, the role is the one the rule was aggregated from.
+type sourcedRule struct {
+	role  string
+	index int
+	rule  rbacv1.PolicyRule
+}
+
+type coverage struct {
+	policy       *Policy
+	clusterRoles map[string]*rbacv1.ClusterRole
+	roles        map[string]*rbacv1.Role
+	hitRules     map[string]bool
+	hitRoles     map[string]bool
+	hitBindings  map[string]bool
+}
+
+func ruleKey(role string, index int) string {
+	return fmt.Sprintf("%s#%d", role, index)
+}
+
+// clusterRoleRules returns the rules of a cluster role, resolving the
+// aggregation rules to the selected roles.
+func (c *coverage) clusterRoleRules(role *rbacv1.ClusterRole, visited map[string]bool) []sourcedRule {
+	name := clusterRoleName(role.Name)
+	if visited[name] {
+		return nil
+	}
+
+	visited[name] = true
+	if role.AggregationRule == nil {
+		rules := make([]sourcedRule, 0, len(role.Rules))
+		for i, r := range role.Rules {
+			rules = append(rules, sourcedRule{role: name, index: i, rule: r})
+		}
+
+		return rules
+	}
+
+	var rules []sourcedRule
+	for _, s := range role.AggregationRule.ClusterRoleSelectors {
+		selector, err := metav1.LabelSelectorAsSelector(&s)
+		if err != nil {
+			continue
+		}
+
+		for _, selected := range c.policy.ClusterRoles {
+			if selected != role && selector.Matches(labels.Set(selected.Labels)) {
+				rules = append(rules, c.clusterRoleRules(selected, visited)...)
+			}
+		}
+	}
+
+	return rules
+}
+
+func (c *coverage) roleRefRules(ref rbacv1.RoleRef, namespace string) (string, []sourcedRule) {
+	switch ref.Kind {
+	case "ClusterRole":
+		role, ok := c.clusterRoles[ref.Name]
+		if !ok {
+			return clusterRoleName(ref.Name), nil
+		}
+
+		return clusterRoleName(ref.Name), c.clusterRoleRules(role, make(map[string]bool))
+	case "Role":
+		name := roleName(namespace, ref.Name)
+		role, ok := c.roles[name]
+		if !ok {
+			return name, nil
+		}
+
+		rules := make([]sourcedRule, 0, len(role.Rules))
+		for i, r := range role.Rules {
+			rules = append(rules, sourcedRule{role: name, index: i, rule: r})
+		}
+
+		return name, rules
+	default:
+		return "", nil
+	}
+}
+
+func (c *coverage) grant(binding string, ref rbacv1.RoleRef, namespace string, attr Attributes) []Grant {
+	role, rules := c.roleRefRules(ref, namespace)
+
+	var grants []Grant
+	authzAttr := attr.AuthorizerAttributes()
+	for _, r := range rules {
+		r := r
+		if !rbac.RuleAllows(authzAttr, &r.rule) {
+			continue
+		}
+
+		c.hitRules[ruleKey(r.role, r.index)] = true
+		c.hitRoles[r.role] = true
+		c.hitRoles[role] = true
+		c.hitBindings[binding] = true
+		grants = append(grants, Grant{Binding: binding, Role: r.role, Rule: r.index})
+	}
+
+	return grants
+}
+
+func (c *coverage) evaluate(test TestItem) CaseCoverage {
+	cc := CaseCoverage{Name: test.String(), Source: test.Source()}
+	if !test.offline() {
+		cc.Skipped = true
+		return cc
+	}
+
+	attr := test.Attributes()
+	u := attr.UserInfo()
+	for _, b := range c.policy.ClusterRoleBindings {
+		for _, s := range b.Subjects {
+			if appliesTo(u, s, "") {
+				cc.GrantedBy = append(cc.GrantedBy, c.grant(clusterRoleBindingName(b), b.RoleRef, "", attr)...)
+				break
+			}
+		}
+	}
+
+	if attr.NonResource || attr.Namespace == "" {
+		return cc
+	}
+
+	for _, b := range c.policy.RoleBindings {
+		if b.Namespace != attr.Namespace {
+			continue
+		}
+
+		for _, s := range b.Subjects {
+			if appliesTo(u, s, b.Namespace) {
+				cc.GrantedBy = append(cc.GrantedBy, c.grant(roleBindingName(b), b.RoleRef, b.Namespace, attr)...)
+				break
+			}
+		}
+	}
+
+	return cc
+}
+
+// Coverage evaluates the expanded test cases of the items against the
+// policy, and reports which rules, roles and bindings of the manifests are
+// never exercised by them. The manifests policy must be part of the policy,
+// e.g. merged into it with Merge. Subjects of the manifest bindings that
+// don't match any test case are reported as untested.
+func Coverage(policy, manifests *Policy, items []TestItem) *CoverageReport {
+	c := &coverage{
+		policy:       policy,
+		clusterRoles: make(map[string]*rbacv1.ClusterRole),
+		roles:        make(map[string]*rbacv1.Role),
+		hitRules:     make(map[string]bool),
+		hitRoles:     make(map[string]bool),
+		hitBindings:  make(map[string]bool),
+	}
+
+	for _, r := range policy.ClusterRoles {
+		c.clusterRoles[r.Name] = r
+	}
+
+	for _, r := range policy.Roles {
+		c.roles[roleName(r.Namespace, r.Name)] = r
+	}
+
+	report := &CoverageReport{}
+	var users []user.Info
+	for _, item := range items {
+		for _, test := range item.Expand() {
+			report.Cases = append(report.Cases, c.evaluate(test))
+
+			users = append(users, test.Attributes().UserInfo())
+		}
+	}
+
+	addRules := func(role string, rules []rbacv1.PolicyRule) {
+		for i, r := range rules {
+			report.Rules++
+			if c.hitRules[ruleKey(role, i)] {
+				report.CoveredRules++
+				continue
+			}
+
+			report.UncoveredRules = append(report.UncoveredRules, RuleRef{Role: role, Index: i, Rule: r})
+		}
+
+		if !c.hitRoles[role] {
+			report.UncoveredRoles = append(report.UncoveredRoles, role)
+		}
+	}
+
+	for _, r := range manifests.ClusterRoles {
+		// the rules of aggregated roles are counted in the roles they are
+		// aggregated from
+		rules := r.Rules
+		if r.AggregationRule != nil {
+			rules = nil
+		}
+
+		addRules(clusterRoleName(r.Name), rules)
+	}
+
+	for _, r := range manifests.Roles {
+		addRules(roleName(r.Namespace, r.Name), r.Rules)
+	}
+
+	untested := make(map[string]bool)
+	addSubjects := func(binding string, subjects []rbacv1.Subject, namespace string) {
+		if !c.hitBindings[binding] {
+			report.UncoveredBindings = append(report.UncoveredBindings, binding)
+		}
+
+		for _, s := range subjects {
+			if s.Kind == rbacv1.ServiceAccountKind && s.Namespace == "" {
+				s.Namespace = namespace
+			}
+
+			tested := false
+			for _, u := range users {
+				if appliesTo(u, s, namespace) {
+					tested = true
+					break
+				}
+			}
+
+			if !tested {
+				untested[subjectName(s)] = true
+			}
+		}
+	}
+
+	for _, b := range manifests.ClusterRoleBindings {
+		addSubjects(clusterRoleBindingName(b), b.Subjects, "")
+	}
+
+	for _, b := range manifests.RoleBindings {
+		addSubjects(roleBindingName(b), b.Subjects, b.Namespace)
+	}
+
+	for s := range untested {
+		report.UntestedSubjects = append(report.UntestedSubjects, s)
+	}
+
+	sort.Strings(report.UncoveredRoles)
+	sort.Strings(report.UncoveredBindings)
+	sort.Strings(report.UntestedSubjects)
+	if report.Rules > 0 {
+		report.Percentage = 100 * float64(report.CoveredRules) / float64(report.Rules)
+	}
+
+	return report
+}
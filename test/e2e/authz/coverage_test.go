@@ -0,0 +1,178 @@
+package authz
+
+import (
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	readPods        = rbacv1.PolicyRule{Verbs: []string{"get", "list"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	readNodes       = rbacv1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"nodes"}}
+	deletePods      = rbacv1.PolicyRule{Verbs: []string{"delete"}, APIGroups: []string{""}, Resources: []string{"pods"}}
+	readLogs        = rbacv1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods/log"}}
+	createConfigMap = rbacv1.PolicyRule{Verbs: []string{"create"}, APIGroups: []string{""}, Resources: []string{"configmaps"}}
+	deleteConfigMap = rbacv1.PolicyRule{Verbs: []string{"delete"}, APIGroups: []string{""}, Resources: []string{"configmaps"}}
+)
+
+func testCoveragePolicy() *Policy {
+	clusterRoleRef := func(name string) rbacv1.RoleRef {
+		return rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name}
+	}
+
+	return &Policy{
+		ClusterRoles: []*rbacv1.ClusterRole{{
+			ObjectMeta: metav1.ObjectMeta{Name: "reader"},
+			Rules:      []rbacv1.PolicyRule{readPods, readNodes},
+		}, {
+			ObjectMeta: metav1.ObjectMeta{Name: "unused"},
+			Rules:      []rbacv1.PolicyRule{deletePods},
+		}, {
+			ObjectMeta: metav1.ObjectMeta{Name: "aggregated"},
+			AggregationRule: &rbacv1.AggregationRule{
+				ClusterRoleSelectors: []metav1.LabelSelector{{
+					MatchLabels: map[string]string{"aggregate-to-aggregated": "true"},
+				}},
+			},
+		}, {
+			ObjectMeta: metav1.ObjectMeta{Name: "log-reader", Labels: map[string]string{"aggregate-to-aggregated": "true"}},
+			Rules:      []rbacv1.PolicyRule{readLogs},
+		}},
+		ClusterRoleBindings: []*rbacv1.ClusterRoleBinding{{
+			ObjectMeta: metav1.ObjectMeta{Name: "readers"},
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.GroupKind, Name: "ReadOnly"},
+				{Kind: rbacv1.GroupKind, Name: "Auditors"},
+			},
+			RoleRef: clusterRoleRef("reader"),
+		}, {
+			ObjectMeta: metav1.ObjectMeta{Name: "log-readers"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "ReadOnly"}},
+			RoleRef:    clusterRoleRef("aggregated"),
+		}, {
+			ObjectMeta: metav1.ObjectMeta{Name: "unused"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "nobody"}},
+			RoleRef:    clusterRoleRef("unused"),
+		}},
+		Roles: []*rbacv1.Role{{
+			ObjectMeta: metav1.ObjectMeta{Name: "configmap-writer", Namespace: "default"},
+			Rules:      []rbacv1.PolicyRule{createConfigMap, deleteConfigMap},
+		}},
+		RoleBindings: []*rbacv1.RoleBinding{{
+			ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "default"},
+			// the namespace of the service account is the one of the binding
+			Subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "ci"}},
+			RoleRef:  rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "configmap-writer"},
+		}},
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	manifests := testCoveragePolicy()
+	policy, err := (&Policy{}).Merge(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := Parse("test.yaml", []byte(`version: v1
+items:
+- name: read-only users
+  request:
+    users: [test-user]
+    groups:
+    - [ReadOnly]
+    namespaces: [default]
+  items:
+  - name: pods
+    request:
+      verbs: [get]
+      resources: [pods]
+    expect: allowed
+  - name: logs
+    request:
+      verbs: [get]
+      resources: [pods]
+      subresources: [log]
+    expect: allowed
+  - name: no delete
+    request:
+      verbs: [delete]
+      resources: [pods]
+    expect: denied
+  - name: nodes
+    decidedBy: webhook
+    request:
+      verbs: [get]
+      resources: [nodes]
+    expect: allowed
+- name: ci
+  request:
+    users: ["system:serviceaccount:default:ci"]
+    namespaces: [default]
+    verbs: [create]
+    resources: [configmaps]
+  expect: allowed
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Coverage(policy, manifests, items)
+
+	// the grants of the cases, in the order of the matrix
+	expectedCases := []CaseCoverage{{
+		GrantedBy: []Grant{{Binding: "ClusterRoleBinding/readers", Role: "ClusterRole/reader", Rule: 0}},
+	}, {
+		// the rule of an aggregated role is attributed to the role it comes from
+		GrantedBy: []Grant{{Binding: "ClusterRoleBinding/log-readers", Role: "ClusterRole/log-reader", Rule: 0}},
+	}, {
+		// no grants
+	}, {
+		Skipped: true,
+	}, {
+		GrantedBy: []Grant{{Binding: "RoleBinding/default/ci", Role: "Role/default/configmap-writer", Rule: 0}},
+	}}
+
+	if len(report.Cases) != len(expectedCases) {
+		t.Fatalf("expected %d cases, got %d: %+v", len(expectedCases), len(report.Cases), report.Cases)
+	}
+
+	for i, expected := range expectedCases {
+		c := report.Cases[i]
+		if c.Skipped != expected.Skipped || !reflect.DeepEqual(c.GrantedBy, expected.GrantedBy) {
+			t.Errorf("%s: expected skipped %t and grants %+v, got skipped %t and grants %+v", c.Name, expected.Skipped, expected.GrantedBy, c.Skipped, c.GrantedBy)
+		}
+	}
+
+	// the rules of the aggregated role are only counted in the roles they
+	// are aggregated from
+	if report.Rules != 6 || report.CoveredRules != 3 || report.Percentage != 50 {
+		t.Errorf("expected 3 of 6 rules covered (50%%), got %d of %d (%.1f%%)", report.CoveredRules, report.Rules, report.Percentage)
+	}
+
+	expectedRules := []RuleRef{
+		{Role: "ClusterRole/reader", Index: 1, Rule: readNodes},
+		{Role: "ClusterRole/unused", Index: 0, Rule: deletePods},
+		{Role: "Role/default/configmap-writer", Index: 1, Rule: deleteConfigMap},
+	}
+
+	if !reflect.DeepEqual(report.UncoveredRules, expectedRules) {
+		t.Errorf("expected uncovered rules %+v, got %+v", expectedRules, report.UncoveredRules)
+	}
+
+	for _, check := range []struct {
+		name     string
+		got      []string
+		expected []string
+	}{
+		{"roles", report.UncoveredRoles, []string{"ClusterRole/unused"}},
+		{"bindings", report.UncoveredBindings, []string{"ClusterRoleBinding/unused"}},
+		{"subjects", report.UntestedSubjects, []string{"Group/Auditors", "User/nobody"}},
+	} {
+		if !reflect.DeepEqual(check.got, check.expected) {
+			t.Errorf("expected uncovered %s %v, got %v", check.name, check.expected, check.got)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// Subject is a user together with its groups, as used in the test cases.
+type Subject struct {
+	User   string
+	Groups []string
+}
+
+func (s Subject) String() string {
+	if len(s.Groups) == 0 {
+		return "user " + s.User
+	}
+
+	return strings.Join(s.Groups, ", ")
+}
+
+// Subjects returns the distinct subjects of the expanded test cases. The
+// self reviews are ignored, because their subject is the caller.
+func Subjects(items []TestItem) []Subject {
+	var subjects []Subject
+	seen := make(map[string]bool)
+	for _, item := range items {
+		for _, test := range item.Expand() {
+			if test.Review == SelfSubjectAccessReview {
+				continue
+			}
+
+			attr := test.Attributes()
+			s := Subject{User: attr.User, Groups: attr.Groups}
+			key := fmt.Sprint(s.User, s.Groups)
+			if !seen[key] {
+				seen[key] = true
+				subjects = append(subjects, s)
+			}
+		}
+	}
+
+	return subjects
+}
+
+// Change is a request of a subject that is allowed by only one of two
+// policies.
+type Change struct {
+	Subject    Subject
+	Attributes Attributes
+
+	// Allowed tells whether the request is allowed by the new policy.
+	Allowed bool
+}
+
+func (c Change) String() string {
+	change := "allowed -> denied"
+	if c.Allowed {
+		change = "denied -> allowed"
+	}
+
+	if c.Attributes.NonResource {
+		return fmt.Sprintf("%s: %s %s", change, c.Attributes.Verb, c.Attributes.Path)
+	}
+
+	resource := c.Attributes.Resource
+	if c.Attributes.APIGroup != "" {
+		resource = c.Attributes.APIGroup + "/" + resource
+	}
+
+	if c.Attributes.Subresource != "" {
+		resource += "/" + c.Attributes.Subresource
+	}
+
+	if c.Attributes.Name != "" {
+		resource += " " + c.Attributes.Name
+	}
+
+	namespace := "cluster-wide"
+	if c.Attributes.Namespace != "" {
+		namespace = "in " + c.Attributes.Namespace
+	}
+
+	s := fmt.Sprintf("%s: %s %s %s", change, c.Attributes.Verb, resource, namespace)
+	if len(c.Subject.Groups) > 0 && c.Subject.User != "" {
+		s += " (user " + c.Subject.User + ")"
+	}
+
+	return s
+}
+
+// policyDiff collects the request attributes that can be affected by the
+// differences between two policies.
+type policyDiff struct {
+	attributes map[string]Attributes
+	subjects   []Subject
+}
+
+func (d *policyDiff) addRule(rule rbacv1.PolicyRule, namespaces []string) {
+	add := func(attr Attributes) {
+		d.attributes[fmt.Sprintf("%#v", attr)] = attr
+	}
+
+	for _, verb := range rule.Verbs {
+		for _, path := range rule.NonResourceURLs {
+			add(Attributes{NonResource: true, Verb: verb, Path: path})
+		}
+
+		names := rule.ResourceNames
+		if len(names) == 0 {
+			names = []string{""}
+		}
+
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				parts := strings.SplitN(resource, "/", 2)
+				for _, name := range names {
+					for _, ns := range namespaces {
+						attr := Attributes{
+							Verb:      verb,
+							Namespace: ns,
+							Name:      name,
+							APIGroup:  group,
+							Resource:  parts[0],
+						}
+
+						if len(parts) == 2 {
+							attr.Subresource = parts[1]
+						}
+
+						add(attr)
+					}
+				}
+			}
+		}
+	}
+}
+
+// addRules adds the rules found in only one of the rule lists.
+func (d *policyDiff) addRules(old, new []rbacv1.PolicyRule, namespaces []string) {
+	for _, r := range old {
+		if !containsRule(new, r) {
+			d.addRule(r, namespaces)
+		}
+	}
+
+	for _, r := range new {
+		if !containsRule(old, r) {
+			d.addRule(r, namespaces)
+		}
+	}
+}
+
+func (d *policyDiff) addSubjects(subjects []rbacv1.Subject, namespace string) {
+	for _, s := range subjects {
+		switch s.Kind {
+		case rbacv1.UserKind:
+			d.subjects = append(d.subjects, Subject{User: s.Name})
+		case rbacv1.GroupKind:
+			d.subjects = append(d.subjects, Subject{User: "authz-diff", Groups: []string{s.Name}})
+		case rbacv1.ServiceAccountKind:
+			if s.Namespace != "" {
+				namespace = s.Namespace
+			}
+
+			d.subjects = append(d.subjects, Subject{User: serviceaccount.MakeUsername(namespace, s.Name)})
+		}
+	}
+}
+
+func policyNamespaces(policies ...*Policy) []string {
+	set := map[string]bool{"": true}
+	for _, p := range policies {
+		for _, r := range p.Roles {
+			set[r.Namespace] = true
+		}
+
+		for _, b := range p.RoleBindings {
+			set[b.Namespace] = true
+		}
+	}
+
+	var namespaces []string
+	for ns := range set {
+		namespaces = append(namespaces, ns)
+	}
+
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+func clusterRoleRulesByName(p *Policy) map[string][]rbacv1.PolicyRule {
+	rules := make(map[string][]rbacv1.PolicyRule)
+	for _, r := range p.ClusterRoles {
+		rules[r.Name] = r.Rules
+	}
+
+	return rules
+}
+
+func roleRulesByName(p *Policy) map[string][]rbacv1.PolicyRule {
+	rules := make(map[string][]rbacv1.PolicyRule)
+	for _, r := range p.Roles {
+		rules[roleName(r.Namespace, r.Name)] = r.Rules
+	}
+
+	return rules
+}
+
+// diffAttributes returns the request attributes and the additional subjects
+// that can be affected by the differences between the policies: the rules
+// of changed roles, and all the rules of the roles referenced by changed
+// bindings, in the namespaces where they apply.
+func diffAttributes(old, new *Policy, namespaces []string) *policyDiff {
+	d := &policyDiff{attributes: make(map[string]Attributes)}
+
+	oldClusterRoles, newClusterRoles := clusterRoleRulesByName(old), clusterRoleRulesByName(new)
+	for _, rules := range []map[string][]rbacv1.PolicyRule{oldClusterRoles, newClusterRoles} {
+		for name := range rules {
+			d.addRules(oldClusterRoles[name], newClusterRoles[name], namespaces)
+		}
+	}
+
+	oldRoles, newRoles := roleRulesByName(old), roleRulesByName(new)
+	roleNamespaces := make(map[string]string)
+	for _, p := range []*Policy{old, new} {
+		for _, r := range p.Roles {
+			roleNamespaces[roleName(r.Namespace, r.Name)] = r.Namespace
+		}
+	}
+
+	for name, ns := range roleNamespaces {
+		d.addRules(oldRoles[name], newRoles[name], []string{ns})
+	}
+
+	roleRefRules := func(ref rbacv1.RoleRef, namespace string) []rbacv1.PolicyRule {
+		if ref.Kind == "ClusterRole" {
+			return append(append([]rbacv1.PolicyRule(nil), oldClusterRoles[ref.Name]...), newClusterRoles[ref.Name]...)
+		}
+
+		name := roleName(namespace, ref.Name)
+		return append(append([]rbacv1.PolicyRule(nil), oldRoles[name]...), newRoles[name]...)
+	}
+
+	oldClusterBindings := make(map[string]*rbacv1.ClusterRoleBinding)
+	for _, b := range old.ClusterRoleBindings {
+		oldClusterBindings[b.Name] = b
+	}
+
+	newClusterBindings := make(map[string]*rbacv1.ClusterRoleBinding)
+	for _, b := range new.ClusterRoleBindings {
+		newClusterBindings[b.Name] = b
+	}
+
+	for _, bindings := range []map[string]*rbacv1.ClusterRoleBinding{oldClusterBindings, newClusterBindings} {
+		for name, b := range bindings {
+			o, n := oldClusterBindings[name], newClusterBindings[name]
+			if o != nil && n != nil && reflect.DeepEqual(o.Subjects, n.Subjects) && o.RoleRef == n.RoleRef {
+				continue
+			}
+
+			d.addRules(nil, roleRefRules(b.RoleRef, ""), namespaces)
+			d.addSubjects(b.Subjects, "")
+		}
+	}
+
+	oldBindings := make(map[string]*rbacv1.RoleBinding)
+	for _, b := range old.RoleBindings {
+		oldBindings[roleBindingName(b)] = b
+	}
+
+	newBindings := make(map[string]*rbacv1.RoleBinding)
+	for _, b := range new.RoleBindings {
+		newBindings[roleBindingName(b)] = b
+	}
+
+	for _, bindings := range []map[string]*rbacv1.RoleBinding{oldBindings, newBindings} {
+		for name, b := range bindings {
+			o, n := oldBindings[name], newBindings[name]
+			if o != nil && n != nil && reflect.DeepEqual(o.Subjects, n.Subjects) && o.RoleRef == n.RoleRef {
+				continue
+			}
+
+			d.addRules(nil, roleRefRules(b.RoleRef, b.Namespace), []string{b.Namespace})
+			d.addSubjects(b.Subjects, b.Namespace)
+		}
+	}
+
+	return d
+}
+
+// DiffPolicies returns the requests of the subjects that are allowed by
+// only one of the policies. Only the requests that can be affected by the
+// changed roles and bindings are evaluated, in the namespaces of the
+// policies and the additional namespaces. The subjects of the changed
+// bindings are evaluated too.
+func DiffPolicies(old, new *Policy, subjects []Subject, namespaces []string) ([]Change, error) {
+	allNamespaces := policyNamespaces(old, new)
+	for _, ns := range namespaces {
+		if !contains(allNamespaces, ns) {
+			allNamespaces = append(allNamespaces, ns)
+		}
+	}
+
+	d := diffAttributes(old, new, allNamespaces)
+	subjects = append(append([]Subject(nil), subjects...), d.subjects...)
+
+	var keys []string
+	for k := range d.attributes {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	oldAuthorizer, newAuthorizer := old.Authorizer(), new.Authorizer()
+	var changes []Change
+	seen := make(map[string]bool)
+	for _, s := range subjects {
+		subjectKey := fmt.Sprint(s.User, s.Groups)
+		if seen[subjectKey] {
+			continue
+		}
+
+		seen[subjectKey] = true
+		for _, k := range keys {
+			attr := d.attributes[k]
+			attr.User, attr.Groups = s.User, s.Groups
+
+			oldDecision, _, err := oldAuthorizer.Authorize(context.Background(), attr.AuthorizerAttributes())
+			if err != nil {
+				return nil, err
+			}
+
+			newDecision, _, err := newAuthorizer.Authorize(context.Background(), attr.AuthorizerAttributes())
+			if err != nil {
+				return nil, err
+			}
+
+			oldAllowed := oldDecision == authorizer.DecisionAllow
+			newAllowed := newDecision == authorizer.DecisionAllow
+			if oldAllowed != newAllowed {
+				changes = append(changes, Change{Subject: s, Attributes: attr, Allowed: newAllowed})
+			}
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,80 @@
+package authz
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPolicy(verbs ...string) *Policy {
+	return &Policy{
+		ClusterRoles: []*rbacv1.ClusterRole{{
+			ObjectMeta: metav1.ObjectMeta{Name: "poweruser"},
+			Rules: []rbacv1.PolicyRule{{
+				APIGroups: []string{"apps"},
+				Resources: []string{"deployments"},
+				Verbs:     verbs,
+			}},
+		}},
+		ClusterRoleBindings: []*rbacv1.ClusterRoleBinding{{
+			ObjectMeta: metav1.ObjectMeta{Name: "poweruser"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "PowerUser"}},
+			RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "poweruser"},
+		}},
+	}
+}
+
+func TestDiffPolicies(t *testing.T) {
+	old := testPolicy("get", "list", "delete")
+	new := testPolicy("get", "list", "create")
+	subjects := []Subject{
+		{User: "test-user", Groups: []string{"PowerUser"}},
+		{User: "test-user", Groups: []string{"ReadOnly"}},
+	}
+
+	changes, err := DiffPolicies(old, new, subjects, []string{"teapot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]bool)
+	for _, c := range changes {
+		if c.Subject.Groups[0] != "PowerUser" {
+			t.Errorf("unexpected change for %s: %s", c.Subject, c)
+		}
+
+		found[c.String()] = true
+	}
+
+	for _, expected := range []string{
+		"allowed -> denied: delete apps/deployments cluster-wide (user test-user)",
+		"allowed -> denied: delete apps/deployments in teapot (user test-user)",
+		"denied -> allowed: create apps/deployments cluster-wide (user test-user)",
+		"denied -> allowed: create apps/deployments in teapot (user test-user)",
+	} {
+		if !found[expected] {
+			t.Errorf("change not found: %s, got: %v", expected, changes)
+		}
+	}
+
+	if len(changes) != 4 {
+		t.Errorf("expected 4 changes, got %d: %v", len(changes), changes)
+	}
+}
+
+func TestDiffPoliciesUnchanged(t *testing.T) {
+	changes, err := DiffPolicies(
+		testPolicy("get"),
+		testPolicy("get"),
+		[]Subject{{User: "test-user", Groups: []string{"PowerUser"}}},
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got: %v", changes)
+	}
+}
@@ -0,0 +1,540 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MatrixVersion is the version of the matrix file format supported by Load.
+const MatrixVersion = "v1"
+
+var reviewKinds = []string{SubjectAccessReview, LocalSubjectAccessReview, SelfSubjectAccessReview}
+
+type decodeError struct {
+	file string
+	line int
+	msg  string
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.file, e.line, e.msg)
+}
+
+type decoder struct {
+	file string
+}
+
+func (d *decoder) errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return &decodeError{file: d.file, line: node.Line, msg: fmt.Sprintf(format, args...)}
+}
+
+// Load reads the test items defined in a matrix file. The file can be
+// either YAML or JSON, and it is validated strictly: unknown or duplicate
+// fields, values of the wrong type and items without an expectation are
+// reported with the line where they occur.
+func Load(path string) ([]TestItem, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(path, data)
+}
+
+// LoadDir reads all the matrix files (.yaml, .yml and .json) from a
+// directory, in lexical order of their names.
+func LoadDir(dir string) ([]TestItem, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		switch filepath.Ext(e.Name()) {
+		case ".yaml", ".yml", ".json":
+			if !e.IsDir() {
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+
+	sort.Strings(files)
+
+	var items []TestItem
+	for _, f := range files {
+		fileItems, err := Load(f)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, fileItems...)
+	}
+
+	return items, nil
+}
+
+// Parse decodes the test items from the content of a matrix file. The file
+// name is only used in error messages.
+func Parse(file string, data []byte) ([]TestItem, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	d := &decoder{file: file}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return nil, d.errorf(&doc, "expected a single document")
+	}
+
+	items, err := d.decodeFile(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		for _, test := range item.Expand() {
+			if test.Expect.Status == 0 {
+				return nil, fmt.Errorf("%s: no expectation for %s", test.source, test.Name)
+			}
+
+			if err := test.validateReview(); err != nil {
+				return nil, fmt.Errorf("%s: %v for %s", test.source, err, test.Name)
+			}
+		}
+	}
+
+	return items, nil
+}
+
+func (item TestItem) validateReview() error {
+	attr := item.Attributes()
+	switch item.Review {
+	case LocalSubjectAccessReview:
+		if attr.NonResource || attr.Namespace == "" {
+			return errors.New("LocalSubjectAccessReview without a namespace")
+		}
+	case SelfSubjectAccessReview:
+		if attr.User != "" || attr.UID != "" || len(attr.Groups) > 0 || len(attr.Extra) > 0 {
+			return errors.New("SelfSubjectAccessReview with a user")
+		}
+	}
+
+	return nil
+}
+
+// fields iterates over the key/value pairs of a mapping node, and fails on
+// keys that are not in known or are repeated.
+func (d *decoder) fields(node *yaml.Node, known []string, f func(key string, value *yaml.Node) error) error {
+	if node.Kind != yaml.MappingNode {
+		return d.errorf(node, "expected a mapping, got %s", kindName(node))
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Kind != yaml.ScalarNode {
+			return d.errorf(key, "expected a field name, got %s", kindName(key))
+		}
+
+		if !contains(known, key.Value) {
+			return d.errorf(key, "unknown field %q, expected one of: %s", key.Value, strings.Join(known, ", "))
+		}
+
+		if seen[key.Value] {
+			return d.errorf(key, "duplicate field %q", key.Value)
+		}
+
+		seen[key.Value] = true
+		if err := f(key.Value, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeFile(node *yaml.Node) ([]TestItem, error) {
+	var (
+		version string
+		items   []TestItem
+	)
+
+	err := d.fields(node, []string{"version", "items"}, func(key string, value *yaml.Node) error {
+		var err error
+		switch key {
+		case "version":
+			version, err = d.decodeString(value)
+			if err == nil && version != MatrixVersion {
+				err = d.errorf(value, "unsupported version %q, expected %q", version, MatrixVersion)
+			}
+		case "items":
+			items, err = d.decodeItems(value)
+		}
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if version == "" {
+		return nil, d.errorf(node, "missing field \"version\"")
+	}
+
+	return items, nil
+}
+
+func (d *decoder) decodeItems(node *yaml.Node) ([]TestItem, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, d.errorf(node, "expected a list of items, got %s", kindName(node))
+	}
+
+	var items []TestItem
+	for _, n := range node.Content {
+		item, err := d.decodeItem(n)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (d *decoder) decodeItem(node *yaml.Node) (TestItem, error) {
+	item := TestItem{source: fmt.Sprintf("%s:%d", d.file, node.Line)}
+	err := d.fields(node, []string{"name", "request", "expect", "decidedBy", "review", "denyUnlisted", "items"}, func(key string, value *yaml.Node) error {
+		var err error
+		switch key {
+		case "name":
+			item.Name, err = d.decodeString(value)
+		case "request":
+			item.Request, err = d.decodeRequest(value)
+		case "expect":
+			item.Expect, err = d.decodeExpect(value)
+		case "decidedBy":
+			item.DecidedBy, err = d.decodeString(value)
+			if err == nil && item.DecidedBy != WebhookAuthorizer {
+				err = d.errorf(value, "invalid authorizer %q, expected %q", item.DecidedBy, WebhookAuthorizer)
+			}
+		case "review":
+			item.Review, err = d.decodeString(value)
+			if err == nil && !contains(reviewKinds, item.Review) {
+				err = d.errorf(value, "invalid review %q, expected one of: %s", item.Review, strings.Join(reviewKinds, ", "))
+			}
+		case "denyUnlisted":
+			item.DenyUnlisted, err = d.decodeBool(value)
+		case "items":
+			item.Items, err = d.decodeItems(value)
+		}
+
+		return err
+	})
+	if err != nil {
+		return TestItem{}, err
+	}
+
+	if item.Name == "" {
+		return TestItem{}, d.errorf(node, "missing field \"name\"")
+	}
+
+	return item, nil
+}
+
+func (d *decoder) decodeRequest(node *yaml.Node) (RequestData, error) {
+	var r RequestData
+	stringFields := map[string]*[]string{
+		"namespaces":       &r.Namespaces,
+		"names":            &r.Names,
+		"verbs":            &r.Verbs,
+		"apiGroups":        &r.APIGroups,
+		"resources":        &r.Resources,
+		"subresources":     &r.Subresources,
+		"paths":            &r.Paths,
+		"nonResourceVerbs": &r.NonResourceVerbs,
+		"nonResourcePaths": &r.NonResourcePaths,
+		"users":            &r.Users,
+		"uids":             &r.UIDs,
+		"excludeResources": &r.ExcludeResources,
+	}
+
+	known := []string{"groups", "extra"}
+	for k := range stringFields {
+		known = append(known, k)
+	}
+
+	sort.Strings(known)
+
+	err := d.fields(node, known, func(key string, value *yaml.Node) error {
+		switch key {
+		case "groups":
+			return d.decodeGroups(value, &r)
+		case "extra":
+			return d.decodeExtra(value, &r)
+		}
+
+		values, err := d.decodeStrings(value)
+		if err != nil {
+			return err
+		}
+
+		for i, v := range values {
+			if key == "resources" && strings.HasPrefix(v, "@") && !validResourceToken(v) {
+				return d.errorf(value.Content[i], "invalid resource token %q", v)
+			}
+		}
+
+		*stringFields[key] = values
+		return nil
+	})
+
+	return r, err
+}
+
+func (d *decoder) decodeGroups(node *yaml.Node, r *RequestData) error {
+	if node.Kind != yaml.SequenceNode {
+		return d.errorf(node, "expected a list of group lists, got %s", kindName(node))
+	}
+
+	for _, n := range node.Content {
+		groups, err := d.decodeStrings(n)
+		if err != nil {
+			return err
+		}
+
+		r.Groups = append(r.Groups, groups)
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeExtra(node *yaml.Node, r *RequestData) error {
+	if node.Kind != yaml.SequenceNode {
+		return d.errorf(node, "expected a list of extra attributes, got %s", kindName(node))
+	}
+
+	for _, n := range node.Content {
+		extra := make(map[string][]string)
+		if n.Kind != yaml.MappingNode {
+			return d.errorf(n, "expected a mapping, got %s", kindName(n))
+		}
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, err := d.decodeString(n.Content[i])
+			if err != nil {
+				return err
+			}
+
+			if _, ok := extra[key]; ok {
+				return d.errorf(n.Content[i], "duplicate extra attribute %q", key)
+			}
+
+			extra[key], err = d.decodeStrings(n.Content[i+1])
+			if err != nil {
+				return err
+			}
+		}
+
+		r.Extra = append(r.Extra, extra)
+	}
+
+	return nil
+}
+
+func (d *decoder) decodeExpect(node *yaml.Node) (Response, error) {
+	decision := func(node *yaml.Node) (Response, error) {
+		value, err := d.decodeString(node)
+		if err != nil {
+			return Response{}, err
+		}
+
+		switch value {
+		case "allowed":
+			return Allowed, nil
+		case "denied":
+			return Denied, nil
+		case "undecided":
+			return Undecided, nil
+		default:
+			return Response{}, d.errorf(node, "invalid decision %q, expected one of: allowed, denied, undecided", value)
+		}
+	}
+
+	if node.Kind == yaml.ScalarNode {
+		return decision(node)
+	}
+
+	var (
+		rsp    Response
+		reason []ReasonMatcher
+	)
+
+	err := d.fields(node, []string{"decision", "reason"}, func(key string, value *yaml.Node) error {
+		var err error
+		switch key {
+		case "decision":
+			rsp, err = decision(value)
+		case "reason":
+			reason, err = d.decodeReasons(value)
+		}
+
+		return err
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	if rsp.Status == 0 {
+		return Response{}, d.errorf(node, "missing field \"decision\"")
+	}
+
+	rsp.Reason = reason
+	return rsp, nil
+}
+
+// decodeReasons decodes a list of reason matchers. A string matches the
+// reasons containing it, and a mapping has one of the fields contains,
+// regex, anyOf (a list of matchers) and not (a matcher).
+func (d *decoder) decodeReasons(node *yaml.Node) ([]ReasonMatcher, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, d.errorf(node, "expected a list of reasons, got %s", kindName(node))
+	}
+
+	matchers := make([]ReasonMatcher, 0, len(node.Content))
+	for _, n := range node.Content {
+		m, err := d.decodeReason(n)
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, m)
+	}
+
+	return matchers, nil
+}
+
+func (d *decoder) decodeReason(node *yaml.Node) (ReasonMatcher, error) {
+	if node.Kind == yaml.ScalarNode {
+		value, err := d.decodeString(node)
+		return ReasonMatcher{Contains: value}, err
+	}
+
+	var (
+		m   ReasonMatcher
+		set int
+	)
+
+	err := d.fields(node, []string{"contains", "regex", "anyOf", "not"}, func(key string, value *yaml.Node) error {
+		var err error
+		set++
+		switch key {
+		case "contains":
+			m.Contains, err = d.decodeString(value)
+		case "regex":
+			var expr string
+			if expr, err = d.decodeString(value); err == nil {
+				if m.Regexp, err = regexp.Compile(expr); err != nil {
+					err = d.errorf(value, "invalid regex: %v", err)
+				}
+			}
+		case "anyOf":
+			if m.AnyOf, err = d.decodeReasons(value); err == nil && len(m.AnyOf) == 0 {
+				err = d.errorf(value, "no alternatives")
+			}
+		case "not":
+			var not ReasonMatcher
+			if not, err = d.decodeReason(value); err == nil {
+				m.Not = &not
+			}
+		}
+
+		return err
+	})
+	if err != nil {
+		return ReasonMatcher{}, err
+	}
+
+	if set != 1 {
+		return ReasonMatcher{}, d.errorf(node, "expected one of the fields contains, regex, anyOf and not")
+	}
+
+	return m, nil
+}
+
+func (d *decoder) decodeString(node *yaml.Node) (string, error) {
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		return "", d.errorf(node, "expected a string, got %s", kindName(node))
+	}
+
+	return node.Value, nil
+}
+
+func (d *decoder) decodeBool(node *yaml.Node) (bool, error) {
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+		return false, d.errorf(node, "expected true or false, got %s", kindName(node))
+	}
+
+	// an explicit !!bool tag can be put on any value
+	var value bool
+	if err := node.Decode(&value); err != nil {
+		return false, d.errorf(node, "expected true or false, got %q", node.Value)
+	}
+
+	return value, nil
+}
+
+func (d *decoder) decodeStrings(node *yaml.Node) ([]string, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, d.errorf(node, "expected a list of strings, got %s", kindName(node))
+	}
+
+	values := make([]string, 0, len(node.Content))
+	for _, n := range node.Content {
+		value, err := d.decodeString(n)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func kindName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		return "a document"
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.AliasNode:
+		return "an alias"
+	default:
+		if node.Tag == "!!null" {
+			return "null"
+		}
+
+		return "a scalar"
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
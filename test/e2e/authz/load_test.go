@@ -0,0 +1,356 @@
+package authz
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadMatrix(t *testing.T) {
+	items, err := LoadDir("matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	for _, item := range items {
+		count += len(item.Expand())
+	}
+
+	if count == 0 {
+		t.Fatal("no test cases found in the matrix")
+	}
+
+	// the descriptions are the names of the specs
+	sources := make(map[string]string)
+	for _, item := range items {
+		for _, test := range item.Expand() {
+			description := test.Description()
+			if source, ok := sources[description]; ok {
+				t.Errorf("the cases of %s and %s have the same description %q", source, test.Source(), description)
+			}
+
+			sources[description] = test.Source()
+		}
+	}
+}
+
+func TestDescription(t *testing.T) {
+	items, err := Parse("test.yaml", []byte(`version: v1
+items:
+- name: pods
+  request:
+    users: [test-user]
+    verbs: [get]
+    resources: [pods]
+  expect: allowed
+  items:
+  - name: by name
+    request:
+      names: [default]
+  - name: by name
+    request:
+      namespaces: [default]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := items[0].Expand()
+	if len(cases) != 2 {
+		t.Fatalf("expected 2 cases, got %d", len(cases))
+	}
+
+	// String leaves out the empty attributes, and can't tell the cases apart
+	if cases[0].String() != cases[1].String() {
+		t.Fatalf("expected the same strings, got %q and %q", cases[0], cases[1])
+	}
+
+	for i, expected := range []string{
+		"pods/by name - SubjectAccessReview {User:test-user UID: Groups:[] Extra:map[] NonResource:false Verb:get Path: Namespace: Name:default APIGroup: Resource:pods Subresource:} (test.yaml:10)",
+		"pods/by name - SubjectAccessReview {User:test-user UID: Groups:[] Extra:map[] NonResource:false Verb:get Path: Namespace:default Name: APIGroup: Resource:pods Subresource:} (test.yaml:13)",
+	} {
+		if description := cases[i].Description(); description != expected {
+			t.Errorf("expected the description %q, got %q", expected, description)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		title string
+		doc   string
+		err   string
+	}{{
+		title: "valid",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    verbs: [get, list]
+    groups:
+    - [ReadOnly]
+  expect:
+    decision: undecided
+    reason: [access undecided]
+`,
+	}, {
+		title: "missing version",
+		doc: `items:
+- name: foo
+  expect: allowed
+`,
+		err: "test.yaml:1: missing field \"version\"",
+	}, {
+		title: "unsupported version",
+		doc: `version: v2
+items: []
+`,
+		err: "test.yaml:1: unsupported version",
+	}, {
+		title: "unknown field",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    verb: [get]
+  expect: allowed
+`,
+		err: "test.yaml:5: unknown field \"verb\"",
+	}, {
+		title: "duplicate field",
+		doc: `version: v1
+items:
+- name: foo
+  expect: allowed
+  expect: denied
+`,
+		err: "test.yaml:5: duplicate field \"expect\"",
+	}, {
+		title: "invalid decision",
+		doc: `version: v1
+items:
+- name: foo
+  items:
+  - name: bar
+    expect: maybe
+`,
+		err: "test.yaml:6: invalid decision \"maybe\"",
+	}, {
+		title: "wrong type",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    users: test-user
+  expect: allowed
+`,
+		err: "test.yaml:5: expected a list of strings",
+	}, {
+		title: "missing name",
+		doc: `version: v1
+items:
+- expect: allowed
+`,
+		err: "test.yaml:3: missing field \"name\"",
+	}, {
+		title: "missing expectation",
+		doc: `version: v1
+items:
+- name: foo
+  items:
+  - name: bar
+    expect: allowed
+  - name: baz
+`,
+		err: "test.yaml:7: no expectation for foo/baz",
+	}, {
+		title: "invalid authorizer",
+		doc: `version: v1
+items:
+- name: foo
+  decidedBy: rbac
+  expect: allowed
+`,
+		err: "test.yaml:4: invalid authorizer \"rbac\"",
+	}, {
+		title: "extra, uid and review kinds",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    namespaces: [teapot]
+    verbs: [get]
+    resources: [pods]
+  items:
+  - name: local
+    review: LocalSubjectAccessReview
+    request:
+      users: [test-user]
+      uids: ["42"]
+      extra:
+      - realm: [users]
+      - realm: [services]
+        business-partner-id: ["1234"]
+    expect: allowed
+  - name: self
+    review: SelfSubjectAccessReview
+    expect: allowed
+`,
+	}, {
+		title: "invalid review",
+		doc: `version: v1
+items:
+- name: foo
+  review: AccessReview
+  expect: allowed
+`,
+		err: "test.yaml:4: invalid review \"AccessReview\"",
+	}, {
+		title: "invalid extra",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    extra:
+    - realm: users
+  expect: allowed
+`,
+		err: "test.yaml:6: expected a list of strings",
+	}, {
+		title: "local review without namespace",
+		doc: `version: v1
+items:
+- name: foo
+  review: LocalSubjectAccessReview
+  request:
+    verbs: [get]
+    resources: [nodes]
+  expect: allowed
+`,
+		err: "test.yaml:3: LocalSubjectAccessReview without a namespace for foo",
+	}, {
+		title: "self review with user",
+		doc: `version: v1
+items:
+- name: foo
+  review: SelfSubjectAccessReview
+  request:
+    users: [test-user]
+  expect: allowed
+`,
+		err: "test.yaml:3: SelfSubjectAccessReview with a user for foo",
+	}, {
+		title: "invalid resource token",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    resources: [pods, "@all"]
+  expect: denied
+`,
+		err: "test.yaml:5: invalid resource token \"@all\"",
+	}, {
+		title: "invalid denyUnlisted",
+		doc: `version: v1
+items:
+- name: foo
+  denyUnlisted: "true"
+  expect: denied
+`,
+		err: "test.yaml:4: expected true or false",
+	}, {
+		title: "invalid tagged denyUnlisted",
+		doc: `version: v1
+items:
+- name: foo
+  expect: denied
+  denyUnlisted: !!bool maybe
+`,
+		err: "test.yaml:5: expected true or false, got \"maybe\"",
+	}, {
+		title: "invalid reason regex",
+		doc: `version: v1
+items:
+- name: foo
+  expect:
+    decision: denied
+    reason: [{regex: "denied (to"}]
+`,
+		err: "test.yaml:6: invalid regex",
+	}, {
+		title: "reason with several matchers",
+		doc: `version: v1
+items:
+- name: foo
+  expect:
+    decision: denied
+    reason: [{contains: denied, not: allowed}]
+`,
+		err: "test.yaml:6: expected one of the fields contains, regex, anyOf and not",
+	}, {
+		title: "reason without alternatives",
+		doc: `version: v1
+items:
+- name: foo
+  expect:
+    decision: denied
+    reason: [{anyOf: []}]
+`,
+		err: "test.yaml:6: no alternatives",
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			_, err := Parse("test.yaml", []byte(test.doc))
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Fatalf("expected error starting with %q, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestExpandExtra(t *testing.T) {
+	items, err := Parse("test.yaml", []byte(`version: v1
+items:
+- name: foo
+  request:
+    users: [test-user]
+    extra:
+    - realm: [users]
+    - realm: [services]
+  review: LocalSubjectAccessReview
+  items:
+  - name: bar
+    request:
+      namespaces: [teapot]
+    expect: allowed
+  - name: baz
+    request:
+      namespaces: [teapot]
+      extra:
+      - realm: [bots]
+    expect: denied
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var realms []string
+	for _, test := range items[0].Expand() {
+		if test.Review != LocalSubjectAccessReview {
+			t.Errorf("%s: expected review %s, got %s", test.Name, LocalSubjectAccessReview, test.Review)
+		}
+
+		realms = append(realms, test.Attributes().Extra["realm"][0])
+	}
+
+	if strings.Join(realms, ",") != "users,services,bots" {
+		t.Errorf("unexpected expansion of the extra attributes: %v", realms)
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Package authz contains the authorization test matrix used by the
+authorization e2e tests.
+
+The matrix is a tree of test items. Every level of the tree can set request
+attributes and an expected response, and the tree is expanded into one test
+case for every combination of the attribute values.
+*/
+package authz
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Response is the expected response of a SubjectAccessReview.
+type Response struct {
+	Status  int
+	Allowed bool
+	Denied  bool
+
+	// Reason are the expectations on the reason of the response, which must
+	// all match.
+	Reason []ReasonMatcher
+}
+
+// RequestData holds the attributes of the access reviews of a test item.
+// Every attribute can have multiple values, which are expanded into
+// separate test cases.
+type RequestData struct {
+	Namespaces       []string
+	Names            []string
+	Verbs            []string
+	APIGroups        []string
+	Resources        []string
+	Subresources     []string
+	Paths            []string
+	NonResourceVerbs []string
+	NonResourcePaths []string
+	Users            []string
+	UIDs             []string
+	Groups           [][]string
+	Extra            []map[string][]string
+
+	// ExcludeResources are left out when resolving the resource tokens of
+	// the item and its sub items.
+	ExcludeResources []string
+}
+
+// TestItem is a node of the authorization test matrix.
+type TestItem struct {
+	Name    string
+	Request RequestData
+	Items   []TestItem
+	Expect  Response
+
+	// DecidedBy is set to WebhookAuthorizer when the expected response is
+	// decided by the webhook authorizer in front of RBAC, e.g. when access
+	// to the system namespaces is denied even though RBAC would allow it.
+	DecidedBy string
+
+	// Review is the kind of the access review sent for the item, one of
+	// SubjectAccessReview (the default), LocalSubjectAccessReview and
+	// SelfSubjectAccessReview.
+	Review string
+
+	// DenyUnlisted asserts that the subjects of the item can't do anything
+	// beyond its cases. See UnlistedCases.
+	DenyUnlisted bool
+
+	// source is the file and line where the item was defined
+	source string
+}
+
+func (item TestItem) expandOn(subitems []TestItem, field func(*TestItem) *[]string) []TestItem {
+	values := field(&item)
+	if len(*values) == 0 {
+		return subitems
+	}
+
+	var expanded []TestItem
+	for _, subitem := range subitems {
+		// == 1:
+		// - if it's coming from a lower level, then it's either zero or one, and is considered
+		// as overriding the current level.
+		// - if it's the item from the current level, then no need to expand when there's only one
+		// value.
+		if len(*field(&subitem)) == 1 {
+			expanded = append(expanded, subitem)
+			continue
+		}
+
+		for _, value := range *values {
+			copy := subitem
+			copyField := field(&copy)
+			*copyField = []string{value}
+			expanded = append(expanded, copy)
+		}
+	}
+
+	return expanded
+}
+
+func (item TestItem) expandOnGroups(subitems []TestItem) []TestItem {
+	if len(item.Request.Groups) == 0 {
+		return subitems
+	}
+
+	var expanded []TestItem
+	for _, subitem := range subitems {
+		if len(subitem.Request.Groups) == 1 {
+			expanded = append(expanded, subitem)
+			continue
+		}
+
+		for _, groupSet := range item.Request.Groups {
+			copy := subitem
+			copy.Request.Groups = [][]string{groupSet}
+			expanded = append(expanded, copy)
+		}
+	}
+
+	return expanded
+}
+
+func (item TestItem) expandOnExtra(subitems []TestItem) []TestItem {
+	if len(item.Request.Extra) == 0 {
+		return subitems
+	}
+
+	var expanded []TestItem
+	for _, subitem := range subitems {
+		if len(subitem.Request.Extra) == 1 {
+			expanded = append(expanded, subitem)
+			continue
+		}
+
+		for _, extra := range item.Request.Extra {
+			copy := subitem
+			copy.Request.Extra = []map[string][]string{extra}
+			expanded = append(expanded, copy)
+		}
+	}
+
+	return expanded
+}
+
+// Expand returns the test cases of the item and all its sub items. The
+// returned items have at most one value for every request attribute, and
+// they are named by their path in the tree.
+func (item TestItem) Expand() []TestItem {
+	var all []TestItem
+	if len(item.Items) == 0 {
+		all = append(all, item)
+	} else {
+		for _, subitem := range item.Items {
+			all = append(all, subitem.Expand()...)
+		}
+
+		for i := range all {
+			all[i].Name = fmt.Sprintf("%s/%s", item.Name, all[i].Name)
+		}
+	}
+
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.Namespaces })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.Names })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.Verbs })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.APIGroups })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.Resources })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.Subresources })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.Paths })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.NonResourceVerbs })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.NonResourcePaths })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.Users })
+	all = item.expandOn(all, func(item *TestItem) *[]string { return &item.Request.UIDs })
+	all = item.expandOnGroups(all)
+	all = item.expandOnExtra(all)
+
+	for i := range all {
+		if all[i].Expect.Status == 0 {
+			all[i].Expect = item.Expect
+		}
+
+		if all[i].DecidedBy == "" {
+			all[i].DecidedBy = item.DecidedBy
+		}
+
+		if all[i].Review == "" {
+			all[i].Review = item.Review
+		}
+
+		// the exclusions apply to the resource tokens of the sub items too,
+		// so they're kept for the tokens resolved after the expansion
+		if len(item.Request.ExcludeResources) > 0 && len(item.Items) > 0 {
+			all[i].Request.ExcludeResources = append(
+				append([]string(nil), item.Request.ExcludeResources...),
+				all[i].Request.ExcludeResources...,
+			)
+		}
+	}
+
+	return all
+}
+
+func (item TestItem) String() string {
+	var attr []string
+	addIfExists := func(fields [][]string) {
+		for _, f := range fields {
+			if len(f) > 0 && f[0] != "" {
+				attr = append(attr, f[0])
+			}
+		}
+	}
+
+	if len(item.Request.NonResourceVerbs) > 0 || len(item.Request.NonResourcePaths) > 0 {
+		addIfExists([][]string{
+			item.Request.NonResourceVerbs,
+			item.Request.NonResourcePaths,
+			item.Request.Users,
+			item.Request.UIDs,
+		})
+	} else {
+		addIfExists([][]string{
+			item.Request.Namespaces,
+			item.Request.Names,
+			item.Request.Verbs,
+			item.Request.APIGroups,
+			item.Request.Resources,
+			item.Request.Subresources,
+			item.Request.Paths,
+			item.Request.Users,
+			item.Request.UIDs,
+		})
+	}
+
+	if len(item.Request.Groups) > 0 {
+		attr = append(attr, fmt.Sprint(item.Request.Groups[0]))
+	}
+
+	if len(item.Request.Extra) > 0 {
+		attr = append(attr, fmt.Sprint(item.Request.Extra[0]))
+	}
+
+	if item.Review != "" && item.Review != SubjectAccessReview {
+		attr = append(attr, item.Review)
+	}
+
+	return fmt.Sprintf("%s - %v", item.Name, attr)
+}
+
+// Description describes an expanded test item with all its attributes,
+// including the empty ones, and the file and line where it was defined. Unlike
+// String, it's different for every case of the matrix, e.g. for the names of
+// the specs.
+func (item TestItem) Description() string {
+	review := item.Review
+	if review == "" {
+		review = SubjectAccessReview
+	}
+
+	description := fmt.Sprintf("%s - %s %+v", item.Name, review, item.Attributes())
+	if item.HasResourceTokens() && len(item.Request.ExcludeResources) > 0 {
+		description += fmt.Sprintf(" excluding %v", item.Request.ExcludeResources)
+	}
+
+	return fmt.Sprintf("%s (%s)", description, item.Source())
+}
+
+// Source returns the file and line where the item was defined.
+func (item TestItem) Source() string {
+	return item.source
+}
+
+// The kinds of access reviews supported in the test items.
+const (
+	SubjectAccessReview      = "SubjectAccessReview"
+	LocalSubjectAccessReview = "LocalSubjectAccessReview"
+	SelfSubjectAccessReview  = "SelfSubjectAccessReview"
+)
+
+// WebhookAuthorizer is the value of TestItem.DecidedBy for items decided by
+// the webhook authorizer.
+const WebhookAuthorizer = "webhook"
+
+func expect(status int, allowed, denied bool) Response {
+	return Response{
+		Status:  status,
+		Allowed: allowed,
+		Denied:  denied,
+	}
+}
+
+var (
+	// Undecided is the response when no authorizer had an opinion.
+	Undecided = expect(http.StatusCreated, false, false)
+
+	// Allowed is the response when the request was allowed.
+	Allowed = expect(http.StatusCreated, true, false)
+
+	// Denied is the response when the request was not allowed.
+	Denied = expect(http.StatusCreated, false, true)
+)
@@ -0,0 +1,284 @@
+package authz
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SystemNamespaces are the namespaces documented as system namespaces in the
+// permission tables. All the other namespaces except default are team
+// namespaces.
+var SystemNamespaces = []string{"kube-system", "visibility"}
+
+// The namespace classes are the columns of the permission tables.
+const (
+	ClusterWide = "cluster-wide"
+	DefaultNS   = "default"
+	SystemNS    = "system namespaces"
+	TeamNS      = "team namespaces"
+)
+
+// NamespaceClasses are the columns of the permission tables, in order.
+var NamespaceClasses = []string{ClusterWide, DefaultNS, SystemNS, TeamNS}
+
+func namespaceClass(namespace string) string {
+	switch {
+	case namespace == "":
+		return ClusterWide
+	case namespace == "default":
+		return DefaultNS
+	case contains(SystemNamespaces, namespace):
+		return SystemNS
+	default:
+		return TeamNS
+	}
+}
+
+// Permission is the expected decision for a request of a test case.
+type Permission struct {
+	Namespace string
+	Allowed   bool
+
+	// Reason is the expected reason of the decision, or the name of the test
+	// case without its top level item.
+	Reason string
+}
+
+// PermissionRow holds the permissions for a verb on a resource, or on a non
+// resource path, by namespace class.
+type PermissionRow struct {
+	Resource string
+	Verb     string
+	Cells    map[string][]Permission
+}
+
+// PermissionTable holds the permissions of a subject.
+type PermissionTable struct {
+	Subject string
+	Rows    []PermissionRow
+}
+
+func permissionResource(attr Attributes) string {
+	if attr.NonResource {
+		return attr.Path
+	}
+
+	resource := attr.Resource
+	if attr.APIGroup != "" {
+		resource = attr.APIGroup + "/" + resource
+	}
+
+	if attr.Subresource != "" {
+		resource += "/" + attr.Subresource
+	}
+
+	if attr.Name != "" {
+		resource += " " + attr.Name
+	}
+
+	return resource
+}
+
+func permissionReason(test TestItem) string {
+	if len(test.Expect.Reason) > 0 {
+		reasons := make([]string, 0, len(test.Expect.Reason))
+		for _, r := range test.Expect.Reason {
+			reasons = append(reasons, r.String())
+		}
+
+		return strings.Join(reasons, ", ")
+	}
+
+	parts := strings.SplitN(test.Name, "/", 2)
+	return parts[len(parts)-1]
+}
+
+var verbOrder = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}
+
+func verbIndex(verb string) int {
+	for i, v := range verbOrder {
+		if v == verb {
+			return i
+		}
+	}
+
+	return len(verbOrder)
+}
+
+// Permissions returns the expected permissions of the expanded test cases,
+// in one table for every subject. The self reviews are ignored, because
+// their subject is the caller. The resource tokens of the items should be
+// resolved.
+func Permissions(items []TestItem) []PermissionTable {
+	tables := make(map[string]map[string]*PermissionRow)
+	for _, item := range items {
+		for _, test := range item.Expand() {
+			if test.Review == SelfSubjectAccessReview {
+				continue
+			}
+
+			attr := test.Attributes()
+			subject := Subject{User: attr.User, Groups: attr.Groups}.String()
+			if tables[subject] == nil {
+				tables[subject] = make(map[string]*PermissionRow)
+			}
+
+			resource := permissionResource(attr)
+			key := resource + " " + attr.Verb
+			row := tables[subject][key]
+			if row == nil {
+				row = &PermissionRow{Resource: resource, Verb: attr.Verb, Cells: make(map[string][]Permission)}
+				tables[subject][key] = row
+			}
+
+			class := namespaceClass(attr.Namespace)
+			p := Permission{Namespace: attr.Namespace, Allowed: test.Expect.Allowed, Reason: permissionReason(test)}
+			if !containsPermission(row.Cells[class], p) {
+				row.Cells[class] = append(row.Cells[class], p)
+			}
+		}
+	}
+
+	var result []PermissionTable
+	for subject, rows := range tables {
+		table := PermissionTable{Subject: subject}
+		for _, row := range rows {
+			table.Rows = append(table.Rows, *row)
+		}
+
+		sort.Slice(table.Rows, func(i, j int) bool {
+			a, b := table.Rows[i], table.Rows[j]
+			if a.Resource != b.Resource {
+				return a.Resource < b.Resource
+			}
+
+			if verbIndex(a.Verb) != verbIndex(b.Verb) {
+				return verbIndex(a.Verb) < verbIndex(b.Verb)
+			}
+
+			return a.Verb < b.Verb
+		})
+
+		result = append(result, table)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Subject < result[j].Subject })
+	return result
+}
+
+func containsPermission(permissions []Permission, p Permission) bool {
+	for _, existing := range permissions {
+		if existing == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Cell returns the text of the permissions of a namespace class, e.g.
+// "denied in kube-system, visibility (no access to secrets)". It's empty
+// when the matrix has no case for the class.
+func (r PermissionRow) Cell(class string) string {
+	type decision struct {
+		allowed bool
+		reason  string
+	}
+
+	var decisions []decision
+	namespaces := make(map[decision][]string)
+	for _, p := range r.Cells[class] {
+		d := decision{allowed: p.Allowed, reason: p.Reason}
+		if _, ok := namespaces[d]; !ok {
+			decisions = append(decisions, d)
+		}
+
+		if !contains(namespaces[d], p.Namespace) {
+			namespaces[d] = append(namespaces[d], p.Namespace)
+		}
+	}
+
+	var parts []string
+	for _, d := range decisions {
+		text := "denied"
+		if d.allowed {
+			text = "allowed"
+		}
+
+		// the namespaces are only listed for the classes that have many
+		if class == SystemNS || class == TeamNS {
+			text += " in " + strings.Join(namespaces[d], ", ")
+		}
+
+		parts = append(parts, fmt.Sprintf("%s (%s)", text, d.reason))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func markdownEscape(s string) string {
+	return strings.Replace(s, "|", "\\|", -1)
+}
+
+// WriteMarkdown writes the permission tables as Markdown, with a section for
+// every subject.
+func WriteMarkdown(w io.Writer, tables []PermissionTable) error {
+	for i, table := range tables {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+
+		header := append([]string{"resource", "verb"}, NamespaceClasses...)
+		separator := make([]string, len(header))
+		for j := range separator {
+			separator[j] = "---"
+		}
+
+		if _, err := fmt.Fprintf(w, "## %s\n\n| %s |\n| %s |\n", table.Subject, strings.Join(header, " | "), strings.Join(separator, " | ")); err != nil {
+			return err
+		}
+
+		for _, row := range table.Rows {
+			cells := []string{markdownEscape(row.Resource), row.Verb}
+			for _, class := range NamespaceClasses {
+				cells = append(cells, markdownEscape(row.Cell(class)))
+			}
+
+			if _, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | ")); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// WriteCSV writes the permission tables as a single CSV table, with the
+// subject in the first column.
+func WriteCSV(w io.Writer, tables []PermissionTable) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(append([]string{"subject", "resource", "verb"}, NamespaceClasses...)); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		for _, row := range table.Rows {
+			record := []string{table.Subject, row.Resource, row.Verb}
+			for _, class := range NamespaceClasses {
+				record = append(record, row.Cell(class))
+			}
+
+			if err := out.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
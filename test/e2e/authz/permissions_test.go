@@ -0,0 +1,117 @@
+package authz
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const permissionsMatrix = `version: v1
+items:
+- name: read-only users
+  request:
+    users: [test-user]
+    groups:
+    - [ReadOnly]
+  items:
+  - name: no access to secrets
+    request:
+      namespaces: ["", default, kube-system, visibility, teapot]
+      verbs: [get]
+      resources: [secrets]
+    expect: denied
+  - name: read access
+    request:
+      namespaces: [kube-system, teapot]
+      verbs: [list, get]
+      resources: [pods]
+    expect: allowed
+  - name: no access to the ssh keys
+    request:
+      namespaces: [kube-system]
+      verbs: [get]
+      resources: [secrets]
+    expect:
+      decision: undecided
+      reason: ["ssh | keys"]
+- name: self review
+  review: SelfSubjectAccessReview
+  request:
+    verbs: [get]
+    resources: [nodes]
+  expect: allowed
+`
+
+func TestPermissions(t *testing.T) {
+	items, err := Parse("test.yaml", []byte(permissionsMatrix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables := Permissions(items)
+	if len(tables) != 1 || tables[0].Subject != "ReadOnly" {
+		t.Fatalf("expected a single table for ReadOnly, got: %v", tables)
+	}
+
+	var rows []string
+	for _, row := range tables[0].Rows {
+		rows = append(rows, row.Resource+" "+row.Verb)
+	}
+
+	if strings.Join(rows, ",") != "pods get,pods list,secrets get" {
+		t.Errorf("unexpected rows: %v", rows)
+	}
+
+	secrets := tables[0].Rows[2]
+	for class, expected := range map[string]string{
+		ClusterWide: "denied (no access to secrets)",
+		DefaultNS:   "denied (no access to secrets)",
+		SystemNS:    "denied in kube-system, visibility (no access to secrets); denied in kube-system (ssh | keys)",
+		TeamNS:      "denied in teapot (no access to secrets)",
+	} {
+		if got := secrets.Cell(class); got != expected {
+			t.Errorf("%s: expected %q, got %q", class, expected, got)
+		}
+	}
+
+	if got := tables[0].Rows[0].Cell(DefaultNS); got != "" {
+		t.Errorf("expected an empty cell, got %q", got)
+	}
+}
+
+func TestWritePermissions(t *testing.T) {
+	items, err := Parse("test.yaml", []byte(permissionsMatrix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var markdown bytes.Buffer
+	if err := WriteMarkdown(&markdown, Permissions(items)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"## ReadOnly\n",
+		"| resource | verb | cluster-wide | default | system namespaces | team namespaces |\n",
+		"| pods | get |  |  | allowed in kube-system (read access) | allowed in teapot (read access) |\n",
+		`(ssh \| keys)`,
+	} {
+		if !strings.Contains(markdown.String(), expected) {
+			t.Errorf("not found in the Markdown output: %q\n%s", expected, markdown.String())
+		}
+	}
+
+	var csv bytes.Buffer
+	if err := WriteCSV(&csv, Permissions(items)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and 3 rows, got:\n%s", csv.String())
+	}
+
+	if lines[1] != "ReadOnly,pods,get,,,allowed in kube-system (read access),allowed in teapot (read access)" {
+		t.Errorf("unexpected CSV row: %s", lines[1])
+	}
+}
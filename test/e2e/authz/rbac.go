@@ -0,0 +1,335 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/clusterconfig"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	rbacregistryvalidation "k8s.io/kubernetes/pkg/registry/rbac/validation"
+	"k8s.io/kubernetes/plugin/pkg/auth/authorizer/rbac"
+	"k8s.io/kubernetes/plugin/pkg/auth/authorizer/rbac/bootstrappolicy"
+)
+
+// PolicyManifests are the patterns, relative to the manifests directory, of
+// the files containing the RBAC policy of the cluster.
+var PolicyManifests = []string{
+	"roles/*.yaml",
+	"psp/*.yaml",
+	"*/*rbac.yaml",
+	"skipper/skipper-default-filter-writers.yaml",
+}
+
+// Policy is the RBAC policy of a cluster.
+type Policy struct {
+	Roles               []*rbacv1.Role
+	RoleBindings        []*rbacv1.RoleBinding
+	ClusterRoles        []*rbacv1.ClusterRole
+	ClusterRoleBindings []*rbacv1.ClusterRoleBinding
+}
+
+// BootstrapPolicy returns the default policy created by the apiserver.
+func BootstrapPolicy() *Policy {
+	p := &Policy{}
+	for _, r := range append(bootstrappolicy.ClusterRoles(), bootstrappolicy.ControllerRoles()...) {
+		r := r
+		p.ClusterRoles = append(p.ClusterRoles, &r)
+	}
+
+	for _, b := range append(bootstrappolicy.ClusterRoleBindings(), bootstrappolicy.ControllerRoleBindings()...) {
+		b := b
+		p.ClusterRoleBindings = append(p.ClusterRoleBindings, &b)
+	}
+
+	for ns, roles := range bootstrappolicy.NamespaceRoles() {
+		for _, r := range roles {
+			r := r
+			r.Namespace = ns
+			p.Roles = append(p.Roles, &r)
+		}
+	}
+
+	for ns, bindings := range bootstrappolicy.NamespaceRoleBindings() {
+		for _, b := range bindings {
+			b := b
+			b.Namespace = ns
+			p.RoleBindings = append(p.RoleBindings, &b)
+		}
+	}
+
+	return p
+}
+
+// LoadClusterManifests renders the policy manifests of a cluster directory,
+// like cluster in this repository, using its config defaults.
+func LoadClusterManifests(clusterDir string, config *clusterconfig.ClusterConfig) (*Policy, error) {
+	config, err := config.WithDefaults(filepath.Join(clusterDir, "config-defaults.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadManifests(filepath.Join(clusterDir, "manifests"), config)
+}
+
+// LoadManifests renders the policy manifests from the manifests directory
+// with the given cluster config, and returns the policy defined by them.
+func LoadManifests(manifestsDir string, config *clusterconfig.ClusterConfig) (*Policy, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, pattern := range PolicyManifests {
+		matches, err := filepath.Glob(filepath.Join(manifestsDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+
+	sort.Strings(files)
+
+	p := &Policy{}
+	for _, f := range files {
+		rendered, err := clusterconfig.RenderFile(f, config)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.add(rendered); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+	}
+
+	return p, nil
+}
+
+// LoadPolicy returns the policy defined by the manifests together with the
+// bootstrap policy, with the aggregated cluster roles resolved.
+func LoadPolicy(manifestsDir string, config *clusterconfig.ClusterConfig) (*Policy, error) {
+	manifests, err := LoadManifests(manifestsDir, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return BootstrapPolicy().Merge(manifests)
+}
+
+// Merge returns a policy containing the objects of both policies, with the
+// aggregated cluster roles resolved. The objects are shared with the
+// original policies.
+func (p *Policy) Merge(other *Policy) (*Policy, error) {
+	merged := &Policy{
+		Roles:               append(append([]*rbacv1.Role(nil), p.Roles...), other.Roles...),
+		RoleBindings:        append(append([]*rbacv1.RoleBinding(nil), p.RoleBindings...), other.RoleBindings...),
+		ClusterRoles:        append(append([]*rbacv1.ClusterRole(nil), p.ClusterRoles...), other.ClusterRoles...),
+		ClusterRoleBindings: append(append([]*rbacv1.ClusterRoleBinding(nil), p.ClusterRoleBindings...), other.ClusterRoleBindings...),
+	}
+
+	if err := merged.aggregate(); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// add decodes the RBAC objects from a multi document manifest, and ignores
+// the other kinds.
+func (p *Policy) add(manifest []byte) error {
+	decoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if len(raw) == 0 || string(raw) == "null" {
+			continue
+		}
+
+		var meta metav1.TypeMeta
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return err
+		}
+
+		var err error
+		switch meta.Kind {
+		case "Role":
+			r := &rbacv1.Role{}
+			err = json.Unmarshal(raw, r)
+			p.Roles = append(p.Roles, r)
+		case "RoleBinding":
+			b := &rbacv1.RoleBinding{}
+			err = json.Unmarshal(raw, b)
+			p.RoleBindings = append(p.RoleBindings, b)
+		case "ClusterRole":
+			r := &rbacv1.ClusterRole{}
+			err = json.Unmarshal(raw, r)
+			p.ClusterRoles = append(p.ClusterRoles, r)
+		case "ClusterRoleBinding":
+			b := &rbacv1.ClusterRoleBinding{}
+			err = json.Unmarshal(raw, b)
+			p.ClusterRoleBindings = append(p.ClusterRoleBindings, b)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// aggregate sets the rules of the cluster roles with an aggregation rule,
+// the same way as the clusterrole aggregation controller does. Aggregated
+// roles can select other aggregated roles, so it repeats until there are
+// no more changes.
+func (p *Policy) aggregate() error {
+	for changed := true; changed; {
+		changed = false
+		for _, role := range p.ClusterRoles {
+			if role.AggregationRule == nil {
+				continue
+			}
+
+			var rules []rbacv1.PolicyRule
+			for _, s := range role.AggregationRule.ClusterRoleSelectors {
+				selector, err := metav1.LabelSelectorAsSelector(&s)
+				if err != nil {
+					return fmt.Errorf("cluster role %s: %v", role.Name, err)
+				}
+
+				for _, selected := range p.ClusterRoles {
+					if selected == role || !selector.Matches(labels.Set(selected.Labels)) {
+						continue
+					}
+
+					for _, rule := range selected.Rules {
+						if !containsRule(rules, rule) {
+							rules = append(rules, rule)
+						}
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(rules, role.Rules) {
+				role.Rules = rules
+				changed = true
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsRule(rules []rbacv1.PolicyRule, rule rbacv1.PolicyRule) bool {
+	for _, r := range rules {
+		if reflect.DeepEqual(r, rule) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authorizer returns an in-process RBAC authorizer using the policy.
+func (p *Policy) Authorizer() authorizer.Authorizer {
+	_, roles := rbacregistryvalidation.NewTestRuleResolver(p.Roles, p.RoleBindings, p.ClusterRoles, p.ClusterRoleBindings)
+	return rbac.New(roles, roles, roles, roles)
+}
+
+// UserInfo returns the user of the attributes.
+func (a Attributes) UserInfo() user.Info {
+	return &user.DefaultInfo{Name: a.User, UID: a.UID, Groups: a.Groups, Extra: a.Extra}
+}
+
+// AuthorizerAttributes returns the attributes for an authorizer. Like for a
+// SubjectAccessReview, the groups are used as they are, without adding
+// system:authenticated.
+func (a Attributes) AuthorizerAttributes() authorizer.Attributes {
+	return authorizer.AttributesRecord{
+		User:            a.UserInfo(),
+		Verb:            a.Verb,
+		Namespace:       a.Namespace,
+		APIGroup:        a.APIGroup,
+		Resource:        a.Resource,
+		Subresource:     a.Subresource,
+		Name:            a.Name,
+		ResourceRequest: !a.NonResource,
+		Path:            a.Path,
+	}
+}
+
+// Result is the outcome of evaluating an expanded test item offline.
+type Result struct {
+	Item    TestItem
+	Allowed bool
+	Reason  string
+
+	// Skipped is set for the items that can't be evaluated offline.
+	Skipped bool
+}
+
+// offline tells whether an expanded test item can be evaluated without a
+// cluster. The items decided by the webhook authorizer can't, and neither
+// can the self access reviews, which depend on the caller.
+func (item TestItem) offline() bool {
+	return item.DecidedBy != WebhookAuthorizer && item.Review != SelfSubjectAccessReview
+}
+
+// Mismatch tells whether the RBAC decision differs from the expectation of
+// the test item. RBAC never denies explicitly, so an item expected to be
+// denied or undecided matches when RBAC doesn't allow it.
+func (r Result) Mismatch() bool {
+	return !r.Skipped && r.Allowed != r.Item.Expect.Allowed
+}
+
+func (r Result) String() string {
+	decision := "not allowed"
+	if r.Allowed {
+		decision = "allowed"
+	}
+
+	return fmt.Sprintf("%s: %s: RBAC %s, reason: %q", r.Item.Source(), r.Item, decision, r.Reason)
+}
+
+// Evaluate evaluates all the expanded test cases of the items with the
+// authorizer.
+func Evaluate(a authorizer.Authorizer, items []TestItem) ([]Result, error) {
+	var results []Result
+	for _, item := range items {
+		for _, test := range item.Expand() {
+			if !test.offline() {
+				results = append(results, Result{Item: test, Skipped: true})
+				continue
+			}
+
+			decision, reason, err := a.Authorize(context.Background(), test.Attributes().AuthorizerAttributes())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", test, err)
+			}
+
+			results = append(results, Result{
+				Item:    test,
+				Allowed: decision == authorizer.DecisionAllow,
+				Reason:  reason,
+			})
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,98 @@
+package authz
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/clusterconfig"
+)
+
+const clusterDir = "../../../cluster"
+
+var (
+	coverageReport = flag.String("rbac-coverage-report", "", "file to write the RBAC coverage report to, in JSON")
+	coverageMin    = flag.Float64("rbac-coverage-min", 0, "minimum percentage of the RBAC rules covered by the matrix")
+)
+
+func loadTestPolicy(t *testing.T) (policy, manifests *Policy, items []TestItem, resources []APIResource) {
+	manifests, err := LoadClusterManifests(clusterDir, clusterconfig.E2EClusterConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err = BootstrapPolicy().Merge(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err = LoadDir("matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err = ClusterResources(clusterDir, clusterconfig.E2EClusterConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err = ResolveResources(items, resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return policy, manifests, items, resources
+}
+
+func TestOfflineRBAC(t *testing.T) {
+	policy, _, items, resources := loadTestPolicy(t)
+
+	// the unlisted cases are leaf items, so they're evaluated as they are
+	items = append(items, UnlistedCases(items, resources)...)
+	results, err := Evaluate(policy.Authorizer(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var skipped int
+	for _, r := range results {
+		switch {
+		case r.Skipped:
+			skipped++
+		case r.Mismatch():
+			t.Error(r)
+		}
+	}
+
+	t.Logf("evaluated %d test cases, skipped %d that need a cluster", len(results)-skipped, skipped)
+}
+
+func TestRBACCoverage(t *testing.T) {
+	policy, manifests, items, _ := loadTestPolicy(t)
+	report := Coverage(policy, manifests, items)
+	t.Logf(
+		"%d of %d rules covered (%.1f%%), %d roles and %d bindings not covered, %d subjects not tested",
+		report.CoveredRules,
+		report.Rules,
+		report.Percentage,
+		len(report.UncoveredRoles),
+		len(report.UncoveredBindings),
+		len(report.UntestedSubjects),
+	)
+
+	if *coverageReport != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(*coverageReport, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if report.Percentage < *coverageMin {
+		t.Errorf("RBAC rule coverage %.1f%% is below the minimum of %.1f%%", report.Percentage, *coverageMin)
+	}
+}
@@ -0,0 +1,154 @@
+package authz
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ReasonMatcher is an expectation on the reason of an access review
+// response. Exactly one of Contains, Regexp, AnyOf and Not is set.
+type ReasonMatcher struct {
+	// Contains matches the reasons containing the string.
+	Contains string
+
+	// Regexp matches the reasons matching the regular expression anywhere.
+	Regexp *regexp.Regexp
+
+	// AnyOf matches the reasons matched by any of the alternatives.
+	AnyOf []ReasonMatcher
+
+	// Not matches the reasons not matched by the matcher.
+	Not *ReasonMatcher
+}
+
+// Match tells whether the reason matches.
+func (m ReasonMatcher) Match(reason string) bool {
+	switch {
+	case m.Regexp != nil:
+		return m.Regexp.MatchString(reason)
+	case m.AnyOf != nil:
+		for _, alternative := range m.AnyOf {
+			if alternative.Match(reason) {
+				return true
+			}
+		}
+
+		return false
+	case m.Not != nil:
+		return !m.Not.Match(reason)
+	default:
+		return strings.Contains(reason, m.Contains)
+	}
+}
+
+func (m ReasonMatcher) String() string {
+	switch {
+	case m.Regexp != nil:
+		return "/" + m.Regexp.String() + "/"
+	case m.AnyOf != nil:
+		alternatives := make([]string, 0, len(m.AnyOf))
+		for _, alternative := range m.AnyOf {
+			alternatives = append(alternatives, alternative.String())
+		}
+
+		return "any of (" + strings.Join(alternatives, ", ") + ")"
+	case m.Not != nil:
+		return "not " + m.Not.String()
+	default:
+		return m.Contains
+	}
+}
+
+// longestCommonSubstring returns the longest string contained by both a and
+// b.
+func longestCommonSubstring(a, b string) string {
+	var longest string
+	lengths := make([]int, len(b)+1)
+	for i := 1; i <= len(a); i++ {
+		previous := 0
+		for j := 1; j <= len(b); j++ {
+			current := lengths[j]
+			if a[i-1] == b[j-1] {
+				lengths[j] = previous + 1
+				if lengths[j] > len(longest) {
+					longest = a[i-lengths[j] : i]
+				}
+			} else {
+				lengths[j] = 0
+			}
+
+			previous = current
+		}
+	}
+
+	return longest
+}
+
+// closeness returns the longest part of the matcher found in the reason,
+// and its length relative to the matcher. The expression of a regular
+// expression is compared as it is.
+func (m ReasonMatcher) closeness(reason string) (string, float64) {
+	var text string
+	switch {
+	case m.Regexp != nil:
+		text = m.Regexp.String()
+	case m.AnyOf != nil:
+		alternative, _ := m.closestAlternative(reason)
+		return alternative.closeness(reason)
+	case m.Not != nil:
+		return "", 0
+	default:
+		text = m.Contains
+	}
+
+	if text == "" {
+		return "", 1
+	}
+
+	part := longestCommonSubstring(text, reason)
+	return part, float64(len(part)) / float64(len(text))
+}
+
+// closestAlternative returns the alternative of an AnyOf matcher that is the
+// closest to matching the reason, with the part of it found in the reason.
+func (m ReasonMatcher) closestAlternative(reason string) (ReasonMatcher, string) {
+	var (
+		closestAlternative ReasonMatcher
+		closestPart        string
+		closest            = -1.0
+	)
+
+	for _, alternative := range m.AnyOf {
+		part, c := alternative.closeness(reason)
+		if c > closest {
+			closestAlternative, closestPart, closest = alternative, part, c
+		}
+	}
+
+	return closestAlternative, closestPart
+}
+
+// MatchReason checks the reason of a response against all the matchers, and
+// describes the first matcher that doesn't match. For the alternatives, the
+// description tells which one came the closest.
+func MatchReason(matchers []ReasonMatcher, reason string) error {
+	for _, m := range matchers {
+		if m.Match(reason) {
+			continue
+		}
+
+		switch {
+		case m.Not != nil:
+			return fmt.Errorf("reason must not match %s", m.Not)
+		case m.AnyOf != nil:
+			alternative, part := m.closestAlternative(reason)
+			return fmt.Errorf("reason doesn't match %s, the closest is %s with %q found", m, alternative, part)
+		default:
+			part, _ := m.closeness(reason)
+			return fmt.Errorf("reason doesn't match %s, the longest part found is %q", m, part)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package authz
+
+import (
+	"strings"
+	"testing"
+)
+
+func parseReasons(t *testing.T, reasons string) []ReasonMatcher {
+	items, err := Parse("test.yaml", []byte(`version: v1
+items:
+- name: foo
+  expect:
+    decision: denied
+    reason: `+reasons+`
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return items[0].Expect.Reason
+}
+
+func TestMatchReason(t *testing.T) {
+	const reason = `access denied to secrets in kube-system for "test-user"`
+	for _, test := range []struct {
+		title   string
+		reasons string
+		err     string
+	}{{
+		title:   "contains",
+		reasons: `["access denied", "kube-system"]`,
+	}, {
+		title:   "contains fails",
+		reasons: `["access denied", "in visibility"]`,
+		err:     `reason doesn't match in visibility, the longest part found is "in "`,
+	}, {
+		title:   "regex",
+		reasons: `[{regex: "^access denied to \\w+ in kube-(system|public)"}]`,
+	}, {
+		title:   "regex fails",
+		reasons: `[{regex: "^access allowed"}]`,
+		err:     `reason doesn't match /^access allowed/`,
+	}, {
+		title:   "any of",
+		reasons: `[{anyOf: ["forbidden", {regex: "denied to \\w+"}]}]`,
+	}, {
+		title:   "any of fails with the closest alternative",
+		reasons: `[{anyOf: ["forbidden", "access denied to pods", {contains: "not allowed"}]}]`,
+		err:     `reason doesn't match any of (forbidden, access denied to pods, not allowed), the closest is access denied to pods with "access denied to "`,
+	}, {
+		title:   "not",
+		reasons: `[{not: "visibility"}, {not: {regex: "[Ss]ystem:masters"}}]`,
+	}, {
+		title:   "not fails",
+		reasons: `[{not: {anyOf: ["test-user", "other-user"]}}]`,
+		err:     `reason must not match any of (test-user, other-user)`,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			err := MatchReason(parseReasons(t, test.reasons), reason)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Fatalf("expected error starting with %q, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestLongestCommonSubstring(t *testing.T) {
+	for _, test := range []struct {
+		a, b, expected string
+	}{
+		{"", "foo", ""},
+		{"foo", "bar", ""},
+		{"denied in kube-system", "access denied to secrets in kube-system", " in kube-system"},
+		{"abc", "abc", "abc"},
+	} {
+		if got := longestCommonSubstring(test.a, test.b); got != test.expected {
+			t.Errorf("%q, %q: expected %q, got %q", test.a, test.b, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/clusterconfig"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// The resource tokens can be used in the resources of a test item, and they
+// are replaced by ResolveResources with the matching resources.
+const (
+	// NamespacedResources matches all the namespaced resources.
+	NamespacedResources = "@namespaced"
+
+	// ClusterScopedResources matches all the cluster scoped resources.
+	ClusterScopedResources = "@cluster-scoped"
+
+	// GroupResourcesPrefix followed by the name of an API group matches all
+	// the resources of the group. The core group is called core.
+	GroupResourcesPrefix = "@group:"
+)
+
+// APIResource is a resource served by a cluster.
+type APIResource struct {
+	Group      string
+	Resource   string
+	Namespaced bool
+}
+
+// String returns the resource in the format used in the matrix.
+func (r APIResource) String() string {
+	if r.Group == "" {
+		return r.Resource
+	}
+
+	return r.Group + "/" + r.Resource
+}
+
+// BuiltinResources are the resources served by Kubernetes 1.17 with the
+// default API groups enabled. The resources of aggregated APIs and of custom
+// resource definitions are not included.
+var BuiltinResources = []APIResource{
+	{"", "bindings", true},
+	{"", "componentstatuses", false},
+	{"", "configmaps", true},
+	{"", "endpoints", true},
+	{"", "events", true},
+	{"", "limitranges", true},
+	{"", "namespaces", false},
+	{"", "nodes", false},
+	{"", "persistentvolumeclaims", true},
+	{"", "persistentvolumes", false},
+	{"", "pods", true},
+	{"", "podtemplates", true},
+	{"", "replicationcontrollers", true},
+	{"", "resourcequotas", true},
+	{"", "secrets", true},
+	{"", "serviceaccounts", true},
+	{"", "services", true},
+	{"admissionregistration.k8s.io", "mutatingwebhookconfigurations", false},
+	{"admissionregistration.k8s.io", "validatingwebhookconfigurations", false},
+	{"apiextensions.k8s.io", "customresourcedefinitions", false},
+	{"apiregistration.k8s.io", "apiservices", false},
+	{"apps", "controllerrevisions", true},
+	{"apps", "daemonsets", true},
+	{"apps", "deployments", true},
+	{"apps", "replicasets", true},
+	{"apps", "statefulsets", true},
+	{"authentication.k8s.io", "tokenreviews", false},
+	{"authorization.k8s.io", "localsubjectaccessreviews", true},
+	{"authorization.k8s.io", "selfsubjectaccessreviews", false},
+	{"authorization.k8s.io", "selfsubjectrulesreviews", false},
+	{"authorization.k8s.io", "subjectaccessreviews", false},
+	{"autoscaling", "horizontalpodautoscalers", true},
+	{"batch", "cronjobs", true},
+	{"batch", "jobs", true},
+	{"certificates.k8s.io", "certificatesigningrequests", false},
+	{"coordination.k8s.io", "leases", true},
+	{"discovery.k8s.io", "endpointslices", true},
+	{"events.k8s.io", "events", true},
+	{"extensions", "ingresses", true},
+	{"networking.k8s.io", "ingresses", true},
+	{"networking.k8s.io", "networkpolicies", true},
+	{"node.k8s.io", "runtimeclasses", false},
+	{"policy", "poddisruptionbudgets", true},
+	{"policy", "podsecuritypolicies", false},
+	{"rbac.authorization.k8s.io", "clusterrolebindings", false},
+	{"rbac.authorization.k8s.io", "clusterroles", false},
+	{"rbac.authorization.k8s.io", "rolebindings", true},
+	{"rbac.authorization.k8s.io", "roles", true},
+	{"scheduling.k8s.io", "priorityclasses", false},
+	{"storage.k8s.io", "csidrivers", false},
+	{"storage.k8s.io", "csinodes", false},
+	{"storage.k8s.io", "storageclasses", false},
+	{"storage.k8s.io", "volumeattachments", false},
+}
+
+// customResourceDefinition is the part of a CRD needed to find its
+// resource, common to the v1beta1 and the v1 API.
+type customResourceDefinition struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Group string `json:"group"`
+		Scope string `json:"scope"`
+		Names struct {
+			Plural string `json:"plural"`
+		} `json:"names"`
+	} `json:"spec"`
+}
+
+// CRDResources returns the resources of the custom resource definitions
+// found in the manifests directory, rendered with the cluster config.
+func CRDResources(manifestsDir string, config *clusterconfig.ClusterConfig) ([]APIResource, error) {
+	var resources []APIResource
+	err := filepath.Walk(manifestsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".yaml" {
+			return err
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Contains(content, []byte("CustomResourceDefinition")) {
+			return nil
+		}
+
+		rendered, err := clusterconfig.RenderFile(path, config)
+		if err != nil {
+			return err
+		}
+
+		decoder := yamlutil.NewYAMLOrJSONDecoder(bytes.NewReader(rendered), 4096)
+		for {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+
+			var crd customResourceDefinition
+			if len(raw) == 0 || string(raw) == "null" || json.Unmarshal(raw, &crd) != nil || crd.Kind != "CustomResourceDefinition" {
+				continue
+			}
+
+			resources = append(resources, APIResource{
+				Group:      crd.Spec.Group,
+				Resource:   crd.Spec.Names.Plural,
+				Namespaced: crd.Spec.Scope != "Cluster",
+			})
+		}
+	})
+
+	return resources, err
+}
+
+// ClusterResources returns the built-in resources together with the ones
+// of the custom resource definitions of a cluster directory, like cluster
+// in this repository.
+func ClusterResources(clusterDir string, config *clusterconfig.ClusterConfig) ([]APIResource, error) {
+	config, err := config.WithDefaults(filepath.Join(clusterDir, "config-defaults.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	crds, err := CRDResources(filepath.Join(clusterDir, "manifests"), config)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]APIResource(nil), BuiltinResources...), crds...), nil
+}
+
+func validResourceToken(token string) bool {
+	return token == NamespacedResources ||
+		token == ClusterScopedResources ||
+		strings.HasPrefix(token, GroupResourcesPrefix) && len(token) > len(GroupResourcesPrefix)
+}
+
+func resolveToken(token string, resources []APIResource, exclude []string) []string {
+	var resolved []string
+	for _, r := range resources {
+		// the subresources are only tested explicitly
+		if strings.Contains(r.Resource, "/") || contains(exclude, r.String()) {
+			continue
+		}
+
+		var match bool
+		switch {
+		case token == NamespacedResources:
+			match = r.Namespaced
+		case token == ClusterScopedResources:
+			match = !r.Namespaced
+		default:
+			group := strings.TrimPrefix(token, GroupResourcesPrefix)
+			if group == "core" {
+				group = ""
+			}
+
+			match = r.Group == group
+		}
+
+		if match && !contains(resolved, r.String()) {
+			resolved = append(resolved, r.String())
+		}
+	}
+
+	sort.Strings(resolved)
+	return resolved
+}
+
+// HasResourceTokens tells whether the resources of the item or of its sub
+// items contain resource tokens.
+func (item TestItem) HasResourceTokens() bool {
+	for _, r := range item.Request.Resources {
+		if strings.HasPrefix(r, "@") {
+			return true
+		}
+	}
+
+	for _, subitem := range item.Items {
+		if subitem.HasResourceTokens() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ResolveResources returns a copy of the items where the resource tokens are
+// replaced by the matching resources, except for the ones excluded by the
+// item or its parents.
+func ResolveResources(items []TestItem, resources []APIResource) ([]TestItem, error) {
+	return resolveResources(items, resources, nil)
+}
+
+func resolveResources(items []TestItem, resources []APIResource, exclude []string) ([]TestItem, error) {
+	resolved := make([]TestItem, 0, len(items))
+	for _, item := range items {
+		itemExclude := append(append([]string(nil), exclude...), item.Request.ExcludeResources...)
+
+		var itemResources []string
+		for _, r := range item.Request.Resources {
+			if !strings.HasPrefix(r, "@") {
+				if !contains(itemResources, r) {
+					itemResources = append(itemResources, r)
+				}
+
+				continue
+			}
+
+			matches := resolveToken(r, resources, itemExclude)
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no resources found for %s in %s", item.source, r, item.Name)
+			}
+
+			for _, m := range matches {
+				if !contains(itemResources, m) {
+					itemResources = append(itemResources, m)
+				}
+			}
+		}
+
+		subitems, err := resolveResources(item.Items, resources, itemExclude)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Request.Resources = itemResources
+		item.Items = subitems
+		resolved = append(resolved, item)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,167 @@
+package authz
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/clusterconfig"
+)
+
+func TestResolveResources(t *testing.T) {
+	resources := []APIResource{
+		{"", "pods", true},
+		{"", "pods/log", true},
+		{"", "nodes", false},
+		{"apps", "deployments", true},
+		{"zalando.org", "stacksets", true},
+		{"zalando.org", "awsiamroles", true},
+	}
+
+	for _, test := range []struct {
+		title    string
+		doc      string
+		expected []string
+		err      bool
+	}{{
+		title: "namespaced",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    resources: ["@namespaced"]
+  expect: denied
+`,
+		expected: []string{"apps/deployments", "pods", "zalando.org/awsiamroles", "zalando.org/stacksets"},
+	}, {
+		title: "cluster scoped and explicit resources",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    resources: [secrets, "@cluster-scoped", nodes]
+  expect: denied
+`,
+		expected: []string{"secrets", "nodes"},
+	}, {
+		title: "group with exclusions from the parent",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    excludeResources: [zalando.org/awsiamroles]
+  items:
+  - name: bar
+    request:
+      resources: ["@group:zalando.org"]
+    expect: denied
+`,
+		expected: []string{"zalando.org/stacksets"},
+	}, {
+		title: "core group",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    resources: ["@group:core"]
+  expect: denied
+`,
+		expected: []string{"nodes", "pods"},
+	}, {
+		title: "nothing left",
+		doc: `version: v1
+items:
+- name: foo
+  request:
+    resources: ["@group:apps"]
+    excludeResources: [apps/deployments]
+  expect: denied
+`,
+		err: true,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			items, err := Parse("test.yaml", []byte(test.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resolved, err := ResolveResources(items, resources)
+			if test.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, c := range resolved[0].Expand() {
+				got = append(got, c.Request.Resources...)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+
+			// the e2e test resolves the tokens of the expanded cases, where
+			// an explicit resource can be matched by a token too
+			got = nil
+			add := func(resources []string) {
+				for _, r := range resources {
+					if !contains(got, r) {
+						got = append(got, r)
+					}
+				}
+			}
+
+			for _, c := range items[0].Expand() {
+				if !c.HasResourceTokens() {
+					add(c.Request.Resources)
+					continue
+				}
+
+				resolvedCase, err := ResolveResources([]TestItem{c}, resources)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, rc := range resolvedCase[0].Expand() {
+					add(rc.Request.Resources)
+				}
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("expected %v after the expansion, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestCRDResources(t *testing.T) {
+	config, err := clusterconfig.E2EClusterConfig().WithDefaults(clusterDir + "/config-defaults.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources, err := CRDResources(clusterDir+"/manifests", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"zalando.org/stacksets", "zalando.org/routegroups", "zalando.org/awsiamroles"} {
+		var found bool
+		for _, r := range resources {
+			if r.String() == expected {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Errorf("CRD not found: %s", expected)
+		}
+	}
+}
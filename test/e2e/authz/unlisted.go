@@ -0,0 +1,149 @@
+package authz
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UnlistedNamespaces are the namespaces where the namespaced resources are
+// checked for the items with DenyUnlisted: the default namespace, the system
+// namespaces and a team namespace.
+var UnlistedNamespaces = []string{"default", "kube-system", "visibility", "teapot"}
+
+// UnlistedVerbs are the verbs checked for the items with DenyUnlisted.
+var UnlistedVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}
+
+// denyUnlistedItem is an item with DenyUnlisted, identified by its path in
+// the matrix.
+type denyUnlistedItem struct {
+	path    string
+	exclude []string
+	source  string
+}
+
+func denyUnlistedItems(item TestItem, parent string, exclude []string) []denyUnlistedItem {
+	path := item.Name
+	if parent != "" {
+		path = parent + "/" + item.Name
+	}
+
+	exclude = append(append([]string(nil), exclude...), item.Request.ExcludeResources...)
+
+	var items []denyUnlistedItem
+	if item.DenyUnlisted {
+		items = append(items, denyUnlistedItem{path: path, exclude: exclude, source: item.source})
+	}
+
+	for _, subitem := range item.Items {
+		items = append(items, denyUnlistedItems(subitem, path, exclude)...)
+	}
+
+	return items
+}
+
+func subjectKey(attr Attributes) string {
+	return fmt.Sprint(attr.User, attr.UID, attr.Groups, attr.Extra)
+}
+
+func listedKey(attr Attributes) string {
+	return fmt.Sprint(subjectKey(attr), attr.Namespace, attr.Verb, attr.APIGroup, attr.Resource)
+}
+
+// UnlistedCases returns the test cases asserting that the subjects of the
+// items with DenyUnlisted can do nothing beyond the cases of these items.
+// For every subject of such an item, the UnlistedVerbs are enumerated on the
+// resources, in the UnlistedNamespaces for the namespaced ones, and a case
+// expected to be denied is returned for every request not matching a case
+// of the item. Only the cases without a name and a subresource match. The
+// resources excluded by the item or its parents are left out. The resource
+// tokens of the items must be resolved.
+func UnlistedCases(items []TestItem, resources []APIResource) []TestItem {
+	var cases []TestItem
+	for _, item := range items {
+		targets := denyUnlistedItems(item, "", nil)
+		if len(targets) == 0 {
+			continue
+		}
+
+		expanded := item.Expand()
+		for _, target := range targets {
+			var listed []TestItem
+			for _, test := range expanded {
+				if test.Name == target.path || strings.HasPrefix(test.Name, target.path+"/") {
+					listed = append(listed, test)
+				}
+			}
+
+			cases = append(cases, unlistedCases(target, listed, resources)...)
+		}
+	}
+
+	return cases
+}
+
+func unlistedCases(target denyUnlistedItem, listed []TestItem, resources []APIResource) []TestItem {
+	var subjects []RequestData
+	seenSubjects := make(map[string]bool)
+	listedRequests := make(map[string]bool)
+	for _, test := range listed {
+		// the subject of a self review is the one running the tests
+		if test.Review == SelfSubjectAccessReview {
+			continue
+		}
+
+		attr := test.Attributes()
+		if key := subjectKey(attr); !seenSubjects[key] {
+			seenSubjects[key] = true
+			subjects = append(subjects, RequestData{
+				Users:  test.Request.Users,
+				UIDs:   test.Request.UIDs,
+				Groups: test.Request.Groups,
+				Extra:  test.Request.Extra,
+			})
+		}
+
+		if !attr.NonResource && attr.Name == "" && attr.Subresource == "" {
+			listedRequests[listedKey(attr)] = true
+		}
+	}
+
+	var cases []TestItem
+	for _, subject := range subjects {
+		seenResources := make(map[string]bool)
+		for _, r := range resources {
+			if strings.Contains(r.Resource, "/") || contains(target.exclude, r.String()) || seenResources[r.String()] {
+				continue
+			}
+
+			seenResources[r.String()] = true
+			namespaces := []string{""}
+			if r.Namespaced {
+				namespaces = UnlistedNamespaces
+			}
+
+			for _, ns := range namespaces {
+				for _, verb := range UnlistedVerbs {
+					request := subject
+					request.Verbs = []string{verb}
+					request.Resources = []string{r.String()}
+					if ns != "" {
+						request.Namespaces = []string{ns}
+					}
+
+					test := TestItem{
+						Name:    target.path + "/unlisted",
+						Request: request,
+						Expect:  Denied,
+						source:  target.source,
+					}
+
+					if !listedRequests[listedKey(test.Attributes())] {
+						cases = append(cases, test)
+					}
+				}
+			}
+		}
+	}
+
+	return cases
+}
@@ -0,0 +1,103 @@
+package authz
+
+import (
+	"testing"
+)
+
+func TestUnlistedCases(t *testing.T) {
+	items, err := Parse("test.yaml", []byte(`version: v1
+items:
+- name: read-only users
+  request:
+    users: [test-user]
+    groups:
+    - [ReadOnly]
+  items:
+  - name: exactly read access
+    denyUnlisted: true
+    request:
+      excludeResources: [secrets]
+    items:
+    - name: namespaced
+      request:
+        namespaces: [default, kube-system, visibility, teapot]
+        verbs: [get, list, watch]
+        resources: [pods]
+      expect: allowed
+    - name: not namespaced
+      request:
+        verbs: [get, list, watch]
+        resources: [nodes]
+      expect: allowed
+    - name: named
+      request:
+        verbs: [delete]
+        names: [foo]
+        resources: [nodes]
+      expect: denied
+- name: power users
+  request:
+    users: [test-user]
+    groups:
+    - [PowerUser]
+    verbs: [get]
+    resources: [nodes]
+  expect: allowed
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := UnlistedCases(items, []APIResource{
+		{"", "pods", true},
+		{"", "pods/log", true},
+		{"", "secrets", true},
+		{"", "nodes", false},
+	})
+
+	got := make(map[string]bool)
+	for _, c := range cases {
+		attr := c.Attributes()
+		if c.Name != "read-only users/exactly read access/unlisted" {
+			t.Errorf("unexpected name: %s", c.Name)
+		}
+
+		if !c.Expect.Denied {
+			t.Errorf("%s: expected to be denied", c)
+		}
+
+		if attr.User != "test-user" || len(attr.Groups) != 1 || attr.Groups[0] != "ReadOnly" {
+			t.Errorf("%s: unexpected subject", c)
+		}
+
+		got[attr.Namespace+" "+attr.Verb+" "+attr.Resource] = true
+	}
+
+	for _, expected := range []string{
+		"default create pods",
+		"teapot deletecollection pods",
+		"kube-system patch pods",
+		" delete nodes",
+		" update nodes",
+	} {
+		if !got[expected] {
+			t.Errorf("case not found: %s", expected)
+		}
+	}
+
+	for _, unexpected := range []string{
+		"default get pods",
+		"visibility watch pods",
+		" list nodes",
+		"default get secrets",
+	} {
+		if got[unexpected] {
+			t.Errorf("unexpected case: %s", unexpected)
+		}
+	}
+
+	// pods with 5 verbs in 4 namespaces, nodes with 5 verbs
+	if len(cases) != 25 {
+		t.Errorf("expected 25 cases, got %d", len(cases))
+	}
+}
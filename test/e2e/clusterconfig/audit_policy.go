@@ -0,0 +1,223 @@
+package clusterconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/audit/policy"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// MasterUserData is the user data of the masters, relative to the cluster
+// directory. It holds the audit policies of the API server.
+const MasterUserData = "node-pools/master-default/userdata.yaml"
+
+// The audit policy files of the API server. The read-only policy is used
+// when read access is audited without an audit trail.
+const (
+	AuditPolicyFile         = "/etc/kubernetes/config/audit-policy.yaml"
+	ReadOnlyAuditPolicyFile = "/etc/kubernetes/config/audit-policy-ro.yaml"
+)
+
+// AuditPolicy evaluates an audit policy offline, like the API server.
+type AuditPolicy struct {
+	Policy  *auditinternal.Policy
+	checker policy.Checker
+}
+
+// AuditDecision is the outcome of evaluating the audit policy for a request.
+type AuditDecision struct {
+	Level      auditinternal.Level
+	OmitStages []auditinternal.Stage
+}
+
+// Logs tells whether an event is logged at the stage.
+func (d AuditDecision) Logs(stage auditinternal.Stage) bool {
+	if d.Level == auditinternal.LevelNone {
+		return false
+	}
+
+	for _, omitted := range d.OmitStages {
+		if omitted == stage {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d AuditDecision) String() string {
+	if len(d.OmitStages) == 0 {
+		return string(d.Level)
+	}
+
+	return fmt.Sprintf("%s, omitting %v", d.Level, d.OmitStages)
+}
+
+// LoadAuditPolicy parses an audit policy file.
+func LoadAuditPolicy(data []byte) (*AuditPolicy, error) {
+	p, err := policy.LoadPolicyFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditPolicy{Policy: p, checker: policy.NewChecker(p)}, nil
+}
+
+// LoadClusterAuditPolicy renders the audit policy file at path, like
+// AuditPolicyFile, from the master user data of a cluster directory, using
+// its config defaults.
+func LoadClusterAuditPolicy(clusterDir, path string, config *ClusterConfig) (*AuditPolicy, error) {
+	config, err := config.WithDefaults(filepath.Join(clusterDir, "config-defaults.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	userData := filepath.Join(clusterDir, MasterUserData)
+	content, err := ioutil.ReadFile(userData)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := writeFileContent(string(content), path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", userData, err)
+	}
+
+	rendered, err := RenderTemplate(path, file, config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %v", userData, path, err)
+	}
+
+	p, err := LoadAuditPolicy(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %v", userData, path, err)
+	}
+
+	return p, nil
+}
+
+// Evaluate returns the audit level and the omitted stages of a request. The
+// groups of the user are used as they are, so system:authenticated must be
+// listed when it matters.
+func (p *AuditPolicy) Evaluate(attr authorizer.Attributes) AuditDecision {
+	level, stages := p.checker.LevelAndStages(attr)
+	return AuditDecision{Level: level, OmitStages: stages}
+}
+
+// isTemplateAction tells whether a line only holds a template action.
+func isTemplateAction(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "{{") && strings.HasSuffix(line, "}}")
+}
+
+// templateNesting returns 1 for a template action opening a block, -1 for an
+// action closing one, and 0 otherwise.
+func templateNesting(line string) int {
+	if !isTemplateAction(line) {
+		return 0
+	}
+
+	action := strings.TrimSpace(line)
+	action = strings.TrimSuffix(strings.TrimPrefix(action, "{{"), "}}")
+	action = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(action, "-"), "-"))
+	switch strings.Fields(action + " ")[0] {
+	case "if", "range", "with", "define", "block":
+		return 1
+	case "end":
+		return -1
+	default:
+		return 0
+	}
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// writeFileContent returns the unrendered content of the write_files entry
+// of the path in a cloud-config template, dedented. The template blocks
+// inside of the content are kept, the ones around it or following it are
+// dropped. This way a single file is rendered, because the whole user data
+// depends on much more than the cluster config.
+func writeFileContent(userData, path string) (string, error) {
+	lines := strings.Split(userData, "\n")
+
+	entry := -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "path: "+path {
+			entry = i
+			break
+		}
+	}
+
+	if entry < 0 {
+		return "", fmt.Errorf("file %s not found", path)
+	}
+
+	indent := indentation(lines[entry])
+	var content []string
+	found := false
+	for _, line := range lines[entry+1:] {
+		trimmed := strings.TrimSpace(line)
+		if !found {
+			if trimmed == "content: |" && indentation(line) == indent {
+				found = true
+				continue
+			}
+
+			if trimmed != "" && !isTemplateAction(line) && indentation(line) < indent {
+				break
+			}
+
+			continue
+		}
+
+		if trimmed != "" && !isTemplateAction(line) && indentation(line) <= indent {
+			break
+		}
+
+		content = append(content, line)
+	}
+
+	// the blocks closed but not opened in the content are around the entry
+	var depth int
+	var balanced []string
+	for _, line := range content {
+		nesting := templateNesting(line)
+		if depth+nesting < 0 {
+			continue
+		}
+
+		depth += nesting
+		balanced = append(balanced, line)
+	}
+
+	// the blocks opened at the end belong to the next entries
+	content = balanced
+	for len(content) > 0 {
+		last := content[len(content)-1]
+		if strings.TrimSpace(last) == "" {
+			content = content[:len(content)-1]
+		} else if depth > 0 && templateNesting(last) > 0 {
+			content = content[:len(content)-1]
+			depth--
+		} else {
+			break
+		}
+	}
+
+	if len(content) == 0 {
+		return "", fmt.Errorf("no content found for the file %s", path)
+	}
+
+	prefix := strings.Repeat(" ", indentation(content[0]))
+	for i, line := range content {
+		content[i] = strings.TrimPrefix(line, prefix)
+	}
+
+	return strings.Join(content, "\n") + "\n", nil
+}
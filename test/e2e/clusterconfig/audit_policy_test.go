@@ -0,0 +1,284 @@
+package clusterconfig
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+const clusterDir = "../../../cluster"
+
+func TestWriteFileContent(t *testing.T) {
+	userData := `write_files:
+  - owner: root:root
+    path: /etc/foo.yaml
+    content: |
+      foo:
+      {{ if eq .Cluster.Environment "e2e" }}
+        bar: baz
+      {{ end }}
+
+{{ if eq .Cluster.Environment "test" }}
+  - owner: root:root
+    path: /etc/bar.yaml
+    content: |
+      bar: baz
+{{ end }}
+`
+
+	content, err := writeFileContent(userData, "/etc/foo.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "foo:\n{{ if eq .Cluster.Environment \"e2e\" }}\n  bar: baz\n{{ end }}\n"
+	if content != expected {
+		t.Errorf("expected content %q, got %q", expected, content)
+	}
+
+	content, err = writeFileContent(userData, "/etc/bar.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content != "bar: baz\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	if _, err := writeFileContent(userData, "/etc/baz.yaml"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// TestWriteFileContentMasterUserData checks the audit policies of the user
+// data of the masters, where the read-only policy is written in a template
+// block opened at the end of the content of the other policy.
+func TestWriteFileContentMasterUserData(t *testing.T) {
+	userData, err := ioutil.ReadFile(filepath.Join(clusterDir, MasterUserData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := writeFileContent(string(userData), ReadOnlyAuditPolicyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `apiVersion: audit.k8s.io/v1beta1
+kind: Policy
+rules:
+- level: None
+  userGroups: ["system:serviceaccounts:kube-system"]
+- level: Request
+  verbs: ["watch", "list", "get"]
+  userGroups: ["system:serviceaccounts"]
+  omitStages:
+  - "RequestReceived"
+`
+	if content != expected {
+		t.Errorf("expected content %q, got %q", expected, content)
+	}
+
+	content, err = writeFileContent(string(userData), AuditPolicyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var depth int
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for _, line := range lines {
+		depth += templateNesting(line)
+		if depth < 0 {
+			t.Fatalf("unexpected end of a template block in %q", content)
+		}
+	}
+
+	if depth != 0 {
+		t.Errorf("expected the template blocks of the content to be closed, got %q", content)
+	}
+
+	if last := lines[len(lines)-1]; strings.TrimSpace(last) != `- "RequestReceived"` {
+		t.Errorf("unexpected last line %q", last)
+	}
+}
+
+func productionClusterConfig() *ClusterConfig {
+	config := E2EClusterConfig()
+	config.Environment = "production"
+	return config
+}
+
+func readAccessClusterConfig() *ClusterConfig {
+	config := E2EClusterConfig()
+	config.Environment = "test"
+	config.ConfigItems["enable_default_sa"] = "true"
+	return config
+}
+
+func testUser(name string, groups ...string) user.Info {
+	return &user.DefaultInfo{Name: name, Groups: groups}
+}
+
+func loadTestAuditPolicy(t *testing.T, path string, config *ClusterConfig) *AuditPolicy {
+	p, err := LoadClusterAuditPolicy(clusterDir, path, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestClusterAuditPolicy(t *testing.T) {
+	e2e := loadTestAuditPolicy(t, AuditPolicyFile, E2EClusterConfig())
+	production := loadTestAuditPolicy(t, AuditPolicyFile, productionClusterConfig())
+	readOnly := loadTestAuditPolicy(t, ReadOnlyAuditPolicyFile, readAccessClusterConfig())
+
+	omitReceived := []auditinternal.Stage{auditinternal.StageRequestReceived}
+	for _, test := range []struct {
+		title  string
+		policy *AuditPolicy
+		attr   authorizer.AttributesRecord
+		level  auditinternal.Level
+	}{{
+		title:  "pod creation by the e2e user",
+		policy: e2e,
+		attr:   authorizer.AttributesRecord{User: testUser("kubelet"), Verb: "create", Namespace: "e2e-tests", Resource: "pods", ResourceRequest: true},
+		level:  auditinternal.LevelRequest,
+	}, {
+		title:  "kubelet outside of e2e",
+		policy: production,
+		attr:   authorizer.AttributesRecord{User: testUser("kubelet"), Verb: "create", Namespace: "teapot", Resource: "pods", ResourceRequest: true},
+		level:  auditinternal.LevelNone,
+	}, {
+		title:  "read-only request",
+		policy: production,
+		attr:   authorizer.AttributesRecord{User: testUser("test-user"), Verb: "get", Namespace: "teapot", Resource: "pods", ResourceRequest: true},
+		level:  auditinternal.LevelNone,
+	}, {
+		title:  "secret read",
+		policy: production,
+		attr:   authorizer.AttributesRecord{User: testUser("test-user"), Verb: "get", Namespace: "teapot", Resource: "secrets", ResourceRequest: true},
+		level:  auditinternal.LevelMetadata,
+	}, {
+		title:  "deployment update",
+		policy: production,
+		attr:   authorizer.AttributesRecord{User: testUser("test-user"), Verb: "update", Namespace: "teapot", APIGroup: "apps", Resource: "deployments", ResourceRequest: true},
+		level:  auditinternal.LevelRequest,
+	}, {
+		title:  "health check",
+		policy: production,
+		attr:   authorizer.AttributesRecord{User: testUser("test-user"), Verb: "get", Path: "/healthz/ping"},
+		level:  auditinternal.LevelNone,
+	}, {
+		title:  "read access of a service account",
+		policy: readOnly,
+		attr:   authorizer.AttributesRecord{User: testUser("system:serviceaccount:teapot:default", "system:serviceaccounts"), Verb: "list", Namespace: "teapot", Resource: "pods", ResourceRequest: true},
+		level:  auditinternal.LevelRequest,
+	}, {
+		title:  "read access of a kube-system service account",
+		policy: readOnly,
+		attr:   authorizer.AttributesRecord{User: testUser("system:serviceaccount:kube-system:default", "system:serviceaccounts", "system:serviceaccounts:kube-system"), Verb: "list", Namespace: "kube-system", Resource: "pods", ResourceRequest: true},
+		level:  auditinternal.LevelNone,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			decision := test.policy.Evaluate(test.attr)
+			if decision.Level != test.level {
+				t.Fatalf("expected level %s, got %s", test.level, decision)
+			}
+
+			if decision.Level != auditinternal.LevelNone && (decision.Logs(auditinternal.StageRequestReceived) || !decision.Logs(auditinternal.StageResponseComplete)) {
+				t.Errorf("expected the stages %v to be omitted, got %s", omitReceived, decision)
+			}
+		})
+	}
+}
+
+// TestSecretsAuditLevel makes sure that no policy logs the content of the
+// secrets and of the platform credentials sets.
+func TestSecretsAuditLevel(t *testing.T) {
+	for _, test := range []struct {
+		title  string
+		path   string
+		config *ClusterConfig
+
+		// maxLevel is the highest level allowed
+		maxLevel auditinternal.Level
+	}{{
+		title:    "e2e",
+		path:     AuditPolicyFile,
+		config:   E2EClusterConfig(),
+		maxLevel: auditinternal.LevelMetadata,
+	}, {
+		title:    "production",
+		path:     AuditPolicyFile,
+		config:   productionClusterConfig(),
+		maxLevel: auditinternal.LevelMetadata,
+	}, {
+		title:    "read access",
+		path:     AuditPolicyFile,
+		config:   readAccessClusterConfig(),
+		maxLevel: auditinternal.LevelMetadata,
+	}, {
+		// the request of a read doesn't have a body
+		title:    "read-only policy",
+		path:     ReadOnlyAuditPolicyFile,
+		config:   readAccessClusterConfig(),
+		maxLevel: auditinternal.LevelRequest,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			p := loadTestAuditPolicy(t, test.path, test.config)
+			for _, resource := range []struct {
+				attr authorizer.AttributesRecord
+
+				// pending marks the resources not yet logged at the
+				// Metadata level by the audit policy of the masters, its
+				// violations are reported without failing the test
+				pending bool
+			}{
+				{attr: authorizer.AttributesRecord{Resource: "secrets"}},
+				{attr: authorizer.AttributesRecord{APIGroup: "zalando.org", Resource: "platformcredentialssets"}, pending: true},
+			} {
+				t.Run(resource.attr.Resource, func(t *testing.T) {
+					var violations []string
+					for _, u := range []user.Info{
+						testUser("test-user", "system:authenticated"),
+						testUser("kubelet", "system:authenticated"),
+						testUser("system:serviceaccount:teapot:default", "system:serviceaccounts", "system:authenticated"),
+						testUser("system:serviceaccount:kube-system:default", "system:serviceaccounts", "system:serviceaccounts:kube-system", "system:authenticated"),
+					} {
+						for _, verb := range []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"} {
+							attr := resource.attr
+							attr.User = u
+							attr.Verb = verb
+							attr.Namespace = "teapot"
+							attr.ResourceRequest = true
+
+							level := p.Evaluate(attr).Level
+							if level == auditinternal.LevelRequestResponse || !test.maxLevel.GreaterOrEqual(level) {
+								violations = append(violations, fmt.Sprintf("%s %s %s is audited at %s, expected at most %s", u.GetName(), verb, attr.Resource, level, test.maxLevel))
+							}
+						}
+					}
+
+					pending := resource.pending && test.path == AuditPolicyFile
+					switch {
+					case pending && len(violations) > 0:
+						t.Skipf("pending a change of the audit policy of the masters:\n%s", strings.Join(violations, "\n"))
+					case pending:
+						t.Errorf("%s are no longer audited above %s, remove the pending mark", resource.attr.Resource, test.maxLevel)
+					}
+
+					for _, violation := range violations {
+						t.Error(violation)
+					}
+				})
+			}
+		})
+	}
+}
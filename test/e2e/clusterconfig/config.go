@@ -0,0 +1,123 @@
+/*
+Package clusterconfig renders the templates of the cluster directory, like the
+manifests and the user data of the nodes, with the configuration of a cluster,
+and evaluates the audit policy of the API server rendered this way.
+*/
+package clusterconfig
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ClusterConfig holds the cluster attributes used to render the cluster
+// manifests, as they are set by the cluster registry.
+type ClusterConfig struct {
+	ID                    string
+	Alias                 string
+	Environment           string
+	Region                string
+	LocalID               string
+	InfrastructureAccount string
+	ConfigItems           map[string]string
+}
+
+// E2EClusterConfig returns the configuration of the e2e clusters, as set by
+// cluster_config.sh, with placeholder values for the IDs and the account.
+func E2EClusterConfig() *ClusterConfig {
+	return &ClusterConfig{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		Alias:                 "e2e",
+		Environment:           "e2e",
+		Region:                "eu-central-1",
+		LocalID:               "kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		ConfigItems: map[string]string{
+			"efs_id":      "fs-12345678",
+			"enable_rbac": "true",
+			"vpa_enabled": "true",
+		},
+	}
+}
+
+// templateData exposes the cluster attributes both at the top level and as
+// .Cluster, because the manifests use both forms.
+type templateData struct {
+	*ClusterConfig
+	Cluster *ClusterConfig
+}
+
+var templateFuncs = template.FuncMap{
+	// getAWSAccountID returns the account ID of an infrastructure account
+	// like aws:123456789012
+	"getAWSAccountID": func(account string) string {
+		parts := strings.Split(account, ":")
+		return parts[len(parts)-1]
+	},
+
+	// amiID is only used for the node images, which are not relevant for the
+	// offline evaluation
+	"amiID": func(name, owner string) string {
+		return "ami-" + name
+	},
+}
+
+// RenderFile renders a template file of the cluster directory with the
+// cluster config.
+func RenderFile(path string, config *ClusterConfig) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return RenderTemplate(filepath.Base(path), string(content), config)
+}
+
+// RenderTemplate renders the content of a template with the cluster config.
+// The config items missing in the config are rendered as empty values.
+func RenderTemplate(name, content string, config *ClusterConfig) ([]byte, error) {
+	t, err := template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, templateData{ClusterConfig: config, Cluster: config}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WithDefaults returns a copy of the cluster config where the config items
+// not set in the config are taken from the rendered config defaults file
+// (cluster/config-defaults.yaml).
+func (c *ClusterConfig) WithDefaults(defaultsFile string) (*ClusterConfig, error) {
+	rendered, err := RenderFile(defaultsFile, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaults map[string]string
+	if err := yaml.Unmarshal(rendered, &defaults); err != nil {
+		return nil, fmt.Errorf("%s: %v", defaultsFile, err)
+	}
+
+	withDefaults := *c
+	withDefaults.ConfigItems = make(map[string]string)
+	for k, v := range defaults {
+		withDefaults.ConfigItems[k] = v
+	}
+
+	for k, v := range c.ConfigItems {
+		withDefaults.ConfigItems[k] = v
+	}
+
+	return &withDefaults, nil
+}
@@ -0,0 +1,56 @@
+// Command audit-redaction checks a saved kube-audit log for events of
+// secrets and platform credentials sets logged with more than their
+// metadata. It lists the offending events and fails when there are any.
+//
+// Usage:
+//
+//	audit-redaction [-version audit.k8s.io/v1] <file>|-
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/utils"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func run() error {
+	version := flag.String("version", "audit.k8s.io/v1", "version of the audit events")
+	flag.Parse()
+
+	gv, err := schema.ParseGroupVersion(*version)
+	if err != nil {
+		return err
+	}
+
+	if flag.NArg() != 1 {
+		return fmt.Errorf("expected the audit log file, or - for stdin")
+	}
+
+	var log io.ReadCloser = os.Stdin
+	if flag.Arg(0) != "-" {
+		log, err = os.Open(flag.Arg(0))
+		if err != nil {
+			return err
+		}
+	}
+
+	defer log.Close()
+	report, err := utils.CheckAuditRedaction(log, utils.SensitiveResources, gv)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(report)
+	return report.Err()
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,108 @@
+// Command audit-stats aggregates the requests of a kube-audit log: the top
+// users, the verbs per resource, the denied requests, the slowest requests
+// and the impersonations.
+//
+// Usage:
+//
+//	audit-stats [-format text|json] [-top 10] <file>|-
+//	audit-stats [-format text|json] [-top 10] -from-cluster [-kubeconfig <file>]
+//
+// A saved log is analyzed offline. With -from-cluster the log is read from
+// the /logs/kube-audit.log endpoint of the API server.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/utils"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// openClusterLog opens the audit log of the API server of the kubeconfig.
+func openClusterLog(kubeconfig string) (io.ReadCloser, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := restclient.TransportFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: transport}
+	rsp, err := client.Get(strings.TrimSuffix(config.Host, "/") + "/logs/kube-audit.log")
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		rsp.Body.Close()
+		return nil, fmt.Errorf("failed to read the audit log: %s", rsp.Status)
+	}
+
+	return rsp.Body, nil
+}
+
+func run() error {
+	format := flag.String("format", "text", "output format, text or json")
+	top := flag.Int("top", 10, "number of entries of every list, all when 0")
+	version := flag.String("version", "audit.k8s.io/v1", "version of the audit events")
+	fromCluster := flag.Bool("from-cluster", false, "read the audit log from the API server")
+	kubeconfig := flag.String("kubeconfig", os.Getenv("KUBECONFIG"), "kubeconfig of the cluster, with -from-cluster")
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid format %q, expected text or json", *format)
+	}
+
+	gv, err := schema.ParseGroupVersion(*version)
+	if err != nil {
+		return err
+	}
+
+	var log io.ReadCloser
+	switch {
+	case *fromCluster:
+		log, err = openClusterLog(*kubeconfig)
+	case flag.NArg() != 1:
+		return fmt.Errorf("expected the audit log file, or - for stdin")
+	case flag.Arg(0) == "-":
+		log = os.Stdin
+	default:
+		log, err = os.Open(flag.Arg(0))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	defer log.Close()
+	stats, err := utils.AnalyzeAuditLog(log, gv, *top)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+
+	return stats.WriteText(os.Stdout)
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
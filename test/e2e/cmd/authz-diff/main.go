@@ -0,0 +1,187 @@
+// Command authz-diff prints the permissions that change between two git
+// revisions of the cluster RBAC manifests, grouped by the subjects of the
+// authorization test matrix.
+//
+// Usage:
+//
+//	authz-diff [-repo <dir>] [-matrix <dir>] <old revision> [<new revision>]
+//
+// Without a new revision, the working tree is compared to the old revision.
+package main
+
+import (
+	"archive/tar"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/authz"
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/clusterconfig"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <old revision> [<new revision>]\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// checkout extracts the cluster directory of a git revision into dir.
+func checkout(repo, revision, dir string) error {
+	cmd := exec.Command("git", "-C", repo, "archive", "--format=tar", revision, "cluster")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	r := tar.NewReader(out)
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(h.Name))
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+
+			f, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(f, r)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return cmd.Wait()
+}
+
+func loadRevision(repo, revision string) (*authz.Policy, error) {
+	clusterDir := filepath.Join(repo, "cluster")
+	if revision != "" {
+		dir, err := ioutil.TempDir("", "authz-diff")
+		if err != nil {
+			return nil, err
+		}
+
+		defer os.RemoveAll(dir)
+		if err := checkout(repo, revision, dir); err != nil {
+			return nil, fmt.Errorf("failed to check out %s: %v", revision, err)
+		}
+
+		clusterDir = filepath.Join(dir, "cluster")
+	}
+
+	manifests, err := authz.LoadClusterManifests(clusterDir, clusterconfig.E2EClusterConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	return authz.BootstrapPolicy().Merge(manifests)
+}
+
+func matrixNamespaces(items []authz.TestItem) []string {
+	var namespaces []string
+	for _, item := range items {
+		for _, test := range item.Expand() {
+			ns := test.Attributes().Namespace
+			if ns != "" && !contains(namespaces, ns) {
+				namespaces = append(namespaces, ns)
+			}
+		}
+	}
+
+	return namespaces
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func run() error {
+	repo := flag.String("repo", ".", "root directory of the git repository")
+	matrixDir := flag.String("matrix", "test/e2e/authz/matrix", "directory of the authorization test matrix, relative to the repository")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	items, err := authz.LoadDir(filepath.Join(*repo, *matrixDir))
+	if err != nil {
+		return err
+	}
+
+	old, err := loadRevision(*repo, flag.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	new, err := loadRevision(*repo, flag.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changes, err := authz.DiffPolicies(old, new, authz.Subjects(items), matrixNamespaces(items))
+	if err != nil {
+		return err
+	}
+
+	bySubject := make(map[string][]string)
+	for _, c := range changes {
+		key := c.Subject.String()
+		bySubject[key] = append(bySubject[key], c.String())
+	}
+
+	var subjects []string
+	for s := range bySubject {
+		subjects = append(subjects, s)
+	}
+
+	sort.Strings(subjects)
+	for _, s := range subjects {
+		lines := bySubject[s]
+		sort.Strings(lines)
+		fmt.Printf("%s:\n  %s\n\n", s, strings.Join(lines, "\n  "))
+	}
+
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
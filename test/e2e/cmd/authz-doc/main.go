@@ -0,0 +1,60 @@
+// Command authz-doc prints the permissions expected by the authorization
+// test matrix, in one table for every group of subjects, as Markdown or CSV.
+//
+// Usage:
+//
+//	authz-doc [-repo <dir>] [-matrix <dir>] [-format markdown|csv]
+//
+// The resource tokens of the matrix are resolved from the resources built
+// into Kubernetes and the CRDs of the cluster manifests.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/authz"
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/clusterconfig"
+)
+
+func run() error {
+	repo := flag.String("repo", ".", "root directory of the repository")
+	matrixDir := flag.String("matrix", "test/e2e/authz/matrix", "directory of the authorization test matrix, relative to the repository")
+	format := flag.String("format", "markdown", "output format, markdown or csv")
+	flag.Parse()
+
+	write := authz.WriteMarkdown
+	switch *format {
+	case "markdown":
+	case "csv":
+		write = authz.WriteCSV
+	default:
+		return fmt.Errorf("invalid format %q, expected markdown or csv", *format)
+	}
+
+	items, err := authz.LoadDir(filepath.Join(*repo, *matrixDir))
+	if err != nil {
+		return err
+	}
+
+	resources, err := authz.ClusterResources(filepath.Join(*repo, "cluster"), clusterconfig.E2EClusterConfig())
+	if err != nil {
+		return err
+	}
+
+	items, err = authz.ResolveResources(items, resources)
+	if err != nil {
+		return err
+	}
+
+	return write(os.Stdout, authz.Permissions(items))
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,48 @@
+package e2e
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/dnscheck"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// dnsRecordMaxTTL is the highest TTL of the records of external-dns. The
+// alias records of Route53 have a TTL of 60s.
+const dnsRecordMaxTTL = 300
+
+// waitForDNSRecord waits for the resolvers of DNS_RESOLVERS to return the A
+// record of the hostname, aliasing the load balancer. The load balancer is
+// resolved by the system resolvers.
+func waitForDNSRecord(hostname, loadBalancer string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resolvers, err := dnscheck.ParseResolvers(ctx, nil, E2EDNSResolvers(), E2EHostedZone())
+	if err != nil {
+		return err
+	}
+
+	system, err := dnscheck.SystemResolvers(dnscheck.ResolvConf)
+	if err != nil {
+		return err
+	}
+
+	checker := dnscheck.NewChecker(resolvers)
+	checker.TargetResolver = &system[0]
+
+	report, err := checker.Wait(ctx, dnscheck.Expectation{
+		Name:   hostname,
+		Type:   dns.TypeA,
+		Target: loadBalancer,
+		MaxTTL: dnsRecordMaxTTL,
+	}, 10*time.Second)
+	if err != nil {
+		return err
+	}
+
+	e2elog.Logf("DNS record propagated: %s", report)
+	return nil
+}
@@ -0,0 +1,330 @@
+// Package dnscheck checks the propagation of DNS records, e.g. the ones
+// created by external-dns, at a chosen set of resolvers. Unlike waiting for
+// a hostname to respond, the results of every resolver tell apart a record
+// which was never created, one with the wrong target and a cached NXDOMAIN.
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const defaultTimeout = 5 * time.Second
+
+// Expectation is an expected DNS record.
+type Expectation struct {
+	Name string
+
+	// Type is the record type, e.g. dns.TypeA.
+	Type uint16
+
+	// Target is the expected value of the record, if any. For CNAME records
+	// it's the canonical name. For A and AAAA records it's either an
+	// address, or a hostname which has to share an address with the record,
+	// like the load balancer of an alias record. For other types it's the
+	// presentation format of the value, e.g. the text of a TXT record.
+	Target string
+
+	// MaxTTL is the highest TTL allowed, if not zero.
+	MaxTTL uint32
+}
+
+func (e Expectation) String() string {
+	s := fmt.Sprintf("%s %s", dns.Fqdn(e.Name), dns.TypeToString[e.Type])
+	if e.Target != "" {
+		s += " " + e.Target
+	}
+
+	if e.MaxTTL > 0 {
+		s += fmt.Sprintf(" (ttl <= %d)", e.MaxTTL)
+	}
+
+	return s
+}
+
+// Status is the outcome of the check at a resolver.
+type Status string
+
+const (
+	StatusOK Status = "ok"
+
+	// StatusNXDomain is a name which doesn't exist, or whose absence is
+	// still cached.
+	StatusNXDomain Status = "nxdomain"
+
+	// StatusNoRecords is a name without records of the expected type.
+	StatusNoRecords Status = "no records"
+
+	StatusWrongTarget Status = "wrong target"
+	StatusTTL         Status = "ttl too high"
+
+	// StatusError is a failed query or an error response, e.g. SERVFAIL.
+	StatusError Status = "error"
+)
+
+// Result is the outcome of the check at a resolver.
+type Result struct {
+	Resolver Resolver
+	Status   Status
+	Latency  time.Duration
+
+	// Records are the values of the records of the expected type.
+	Records []string
+	TTL     uint32
+
+	// NegativeTTL is how long a missing name may be cached, from the SOA
+	// record of an NXDOMAIN response.
+	NegativeTTL uint32
+
+	// Err explains a failed check.
+	Err error
+}
+
+func (r Result) String() string {
+	s := fmt.Sprintf("%s: %s in %s", r.Resolver, r.Status, r.Latency.Round(time.Millisecond))
+	if len(r.Records) > 0 {
+		s += fmt.Sprintf(", records %s (ttl %d)", strings.Join(r.Records, " "), r.TTL)
+	}
+
+	if r.Status == StatusNXDomain && r.NegativeTTL > 0 {
+		s += fmt.Sprintf(", cached for up to %ds", r.NegativeTTL)
+	}
+
+	if r.Err != nil {
+		s += fmt.Sprintf(": %v", r.Err)
+	}
+
+	return s
+}
+
+// Report has the results of a check, one per resolver.
+type Report struct {
+	Expectation Expectation
+	Results     []Result
+}
+
+// Failed returns the results of the resolvers that don't return the expected
+// record.
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Status != StatusOK {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
+
+// Err returns an error listing the failed resolvers, or nil.
+func (r *Report) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%s not propagated to %d of %d resolvers:\n%s", r.Expectation, len(failed), len(r.Results), r.results(failed))
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("%s:\n%s", r.Expectation, r.results(r.Results))
+}
+
+func (r *Report) results(results []Result) string {
+	lines := make([]string, 0, len(results))
+	for _, result := range results {
+		lines = append(lines, "  "+result.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Checker queries the expected records at the resolvers.
+type Checker struct {
+	Resolvers []Resolver
+	Client    *dns.Client
+
+	// TargetResolver resolves the hostname targets of A and AAAA records.
+	// By default, they're resolved by the same resolver as the record,
+	// which doesn't work with the authoritative nameservers of another zone.
+	TargetResolver *Resolver
+}
+
+// NewChecker creates a checker for the resolvers, querying them over UDP.
+func NewChecker(resolvers []Resolver) *Checker {
+	return &Checker{
+		Resolvers: resolvers,
+		Client:    &dns.Client{Timeout: defaultTimeout},
+	}
+}
+
+// Check queries the record at every resolver.
+func (c *Checker) Check(ctx context.Context, expected Expectation) *Report {
+	report := &Report{Expectation: expected, Results: make([]Result, len(c.Resolvers))}
+	done := make(chan struct{})
+	for i, r := range c.Resolvers {
+		go func(i int, r Resolver) {
+			report.Results[i] = c.check(ctx, r, expected)
+			done <- struct{}{}
+		}(i, r)
+	}
+
+	for range c.Resolvers {
+		<-done
+	}
+
+	return report
+}
+
+// Wait checks the record every interval until all the resolvers return it,
+// or the context is done. It returns the last report, and when the context is
+// done an error wrapping the one of the context.
+func (c *Checker) Wait(ctx context.Context, expected Expectation, interval time.Duration) (*Report, error) {
+	for {
+		report := c.Check(ctx, expected)
+		err := report.Err()
+		if err == nil {
+			return report, nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return report, fmt.Errorf("%w: %v", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Checker) check(ctx context.Context, r Resolver, expected Expectation) Result {
+	result := Result{Resolver: r}
+	fail := func(status Status, err error) Result {
+		result.Status = status
+		result.Err = err
+		return result
+	}
+
+	start := time.Now()
+	rsp, err := exchange(ctx, c.Client, r, expected.Name, expected.Type)
+	result.Latency = time.Since(start)
+	if err != nil {
+		return fail(StatusError, err)
+	}
+
+	switch rsp.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		for _, rr := range rsp.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				result.NegativeTTL = minTTL(soa.Hdr.Ttl, soa.Minttl)
+			}
+		}
+
+		return fail(StatusNXDomain, nil)
+	default:
+		return fail(StatusError, fmt.Errorf("response %s", dns.RcodeToString[rsp.Rcode]))
+	}
+
+	result.Records = recordValues(rsp.Answer, expected.Type)
+	if len(result.Records) == 0 {
+		return fail(StatusNoRecords, nil)
+	}
+
+	for _, rr := range rsp.Answer {
+		if rr.Header().Rrtype == expected.Type && rr.Header().Ttl > result.TTL {
+			result.TTL = rr.Header().Ttl
+		}
+	}
+
+	if expected.Target != "" {
+		if err := c.checkTarget(ctx, r, expected, result.Records); err != nil {
+			return fail(StatusWrongTarget, err)
+		}
+	}
+
+	if expected.MaxTTL > 0 && result.TTL > expected.MaxTTL {
+		return fail(StatusTTL, fmt.Errorf("expected a ttl of at most %d", expected.MaxTTL))
+	}
+
+	result.Status = StatusOK
+	return result
+}
+
+func (c *Checker) checkTarget(ctx context.Context, r Resolver, expected Expectation, records []string) error {
+	targets := []string{expected.Target}
+	switch expected.Type {
+	case dns.TypeCNAME, dns.TypeNS:
+		targets[0] = strings.ToLower(dns.Fqdn(expected.Target))
+	case dns.TypeA, dns.TypeAAAA:
+		if ip := net.ParseIP(expected.Target); ip != nil {
+			targets[0] = ip.String()
+			break
+		}
+
+		targetResolver := r
+		if c.TargetResolver != nil {
+			targetResolver = *c.TargetResolver
+		}
+
+		addresses, err := lookupAddresses(ctx, c.Client, targetResolver, expected.Target, expected.Type)
+		if err != nil {
+			return err
+		}
+
+		targets = addresses
+	}
+
+	for _, record := range records {
+		for _, target := range targets {
+			if record == target {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("expected %s", strings.Join(targets, " or "))
+}
+
+// recordValues returns the values of the records of the type, sorted.
+func recordValues(records []dns.RR, qtype uint16) []string {
+	var values []string
+	for _, rr := range records {
+		if rr.Header().Rrtype != qtype {
+			continue
+		}
+
+		switch rr := rr.(type) {
+		case *dns.A:
+			values = append(values, rr.A.String())
+		case *dns.AAAA:
+			values = append(values, rr.AAAA.String())
+		case *dns.CNAME:
+			values = append(values, strings.ToLower(rr.Target))
+		case *dns.NS:
+			values = append(values, strings.ToLower(rr.Ns))
+		case *dns.TXT:
+			values = append(values, strings.Join(rr.Txt, ""))
+		default:
+			// the presentation format without the header
+			values = append(values, strings.TrimPrefix(rr.String(), rr.Header().String()))
+		}
+	}
+
+	sort.Strings(values)
+	return values
+}
+
+func minTTL(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,398 @@
+package dnscheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testServer is an in-process nameserver answering from a fixed set of
+// records.
+type testServer struct {
+	t      *testing.T
+	server *dns.Server
+
+	mu      sync.Mutex
+	records []dns.RR
+	soa     dns.RR
+}
+
+func newTestServer(t *testing.T, records ...string) *testServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testServer{t: t, soa: testRR(t, "example.org. 900 IN SOA ns1.example.org. hostmaster.example.org. 1 7200 900 1209600 60")}
+	s.setRecords(records...)
+
+	started := make(chan struct{})
+	s.server = &dns.Server{PacketConn: conn, Handler: s, NotifyStartedFunc: func() { close(started) }}
+	go s.server.ActivateAndServe()
+	<-started
+
+	return s
+}
+
+func testRR(t *testing.T, record string) dns.RR {
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rr
+}
+
+func (s *testServer) setRecords(records ...string) {
+	var rrs []dns.RR
+	for _, record := range records {
+		rrs = append(rrs, testRR(s.t, record))
+	}
+
+	s.mu.Lock()
+	s.records = rrs
+	s.mu.Unlock()
+}
+
+func (s *testServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rsp := new(dns.Msg)
+	rsp.SetReply(req)
+	q := req.Question[0]
+
+	var nameExists bool
+	for _, rr := range s.records {
+		if !strings.EqualFold(rr.Header().Name, q.Name) {
+			continue
+		}
+
+		nameExists = true
+		if rr.Header().Rrtype == q.Qtype {
+			rsp.Answer = append(rsp.Answer, rr)
+		}
+	}
+
+	// the glue of the nameservers
+	for _, answer := range rsp.Answer {
+		if ns, ok := answer.(*dns.NS); ok {
+			for _, rr := range s.records {
+				if rr.Header().Rrtype == dns.TypeA && strings.EqualFold(rr.Header().Name, ns.Ns) {
+					rsp.Extra = append(rsp.Extra, rr)
+				}
+			}
+		}
+	}
+
+	if !nameExists {
+		rsp.Rcode = dns.RcodeNameError
+		rsp.Ns = []dns.RR{s.soa}
+	}
+
+	w.WriteMsg(rsp)
+}
+
+func (s *testServer) resolver(name string) Resolver {
+	return Resolver{Name: name, Address: s.server.PacketConn.LocalAddr().String()}
+}
+
+func (s *testServer) close() {
+	s.server.Shutdown()
+}
+
+func testContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 5*time.Second)
+}
+
+func TestCheck(t *testing.T) {
+	server := newTestServer(t,
+		"alias.example.org. 60 IN A 192.0.2.1",
+		"alias.example.org. 60 IN A 192.0.2.2",
+		"alb.eu-central-1.elb.amazonaws.com. 60 IN A 192.0.2.2",
+		"other-alb.eu-central-1.elb.amazonaws.com. 60 IN A 192.0.2.3",
+		"cname.example.org. 300 IN CNAME alb.eu-central-1.elb.amazonaws.com.",
+		"ownership.example.org. 300 IN TXT \"heritage=external-dns,external-dns/owner=e2e\"",
+		"slow.example.org. 86400 IN A 192.0.2.1",
+	)
+	defer server.close()
+
+	checker := NewChecker([]Resolver{server.resolver("test")})
+	for _, test := range []struct {
+		title    string
+		expected Expectation
+		status   Status
+		records  []string
+	}{{
+		title:    "alias of a load balancer",
+		expected: Expectation{Name: "alias.example.org", Type: dns.TypeA, Target: "alb.eu-central-1.elb.amazonaws.com", MaxTTL: 300},
+		status:   StatusOK,
+		records:  []string{"192.0.2.1", "192.0.2.2"},
+	}, {
+		title:    "alias of another load balancer",
+		expected: Expectation{Name: "alias.example.org", Type: dns.TypeA, Target: "other-alb.eu-central-1.elb.amazonaws.com"},
+		status:   StatusWrongTarget,
+		records:  []string{"192.0.2.1", "192.0.2.2"},
+	}, {
+		title:    "address",
+		expected: Expectation{Name: "alias.example.org", Type: dns.TypeA, Target: "192.0.2.2"},
+		status:   StatusOK,
+		records:  []string{"192.0.2.1", "192.0.2.2"},
+	}, {
+		title:    "cname",
+		expected: Expectation{Name: "cname.example.org", Type: dns.TypeCNAME, Target: "ALB.eu-central-1.elb.amazonaws.com"},
+		status:   StatusOK,
+		records:  []string{"alb.eu-central-1.elb.amazonaws.com."},
+	}, {
+		title:    "txt",
+		expected: Expectation{Name: "ownership.example.org", Type: dns.TypeTXT, Target: "heritage=external-dns,external-dns/owner=e2e"},
+		status:   StatusOK,
+		records:  []string{"heritage=external-dns,external-dns/owner=e2e"},
+	}, {
+		title:    "missing name",
+		expected: Expectation{Name: "missing.example.org", Type: dns.TypeA},
+		status:   StatusNXDomain,
+	}, {
+		title:    "missing type",
+		expected: Expectation{Name: "alias.example.org", Type: dns.TypeAAAA},
+		status:   StatusNoRecords,
+	}, {
+		title:    "ttl",
+		expected: Expectation{Name: "slow.example.org", Type: dns.TypeA, MaxTTL: 300},
+		status:   StatusTTL,
+		records:  []string{"192.0.2.1"},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			ctx, cancel := testContext()
+			defer cancel()
+
+			report := checker.Check(ctx, test.expected)
+			if len(report.Results) != 1 {
+				t.Fatalf("expected one result, got %d", len(report.Results))
+			}
+
+			result := report.Results[0]
+			if result.Status != test.status {
+				t.Errorf("expected status %q, got: %s", test.status, result)
+			}
+
+			if !reflect.DeepEqual(result.Records, test.records) {
+				t.Errorf("expected records %v, got %v", test.records, result.Records)
+			}
+
+			if err := report.Err(); (err == nil) != (test.status == StatusOK) {
+				t.Errorf("unexpected error %v for status %s", err, result.Status)
+			}
+		})
+	}
+}
+
+func TestCheckPerResolver(t *testing.T) {
+	updated := newTestServer(t, "foo.example.org. 60 IN A 192.0.2.1")
+	defer updated.close()
+
+	stale := newTestServer(t)
+	defer stale.close()
+
+	checker := NewChecker([]Resolver{updated.resolver("updated"), stale.resolver("stale")})
+	expected := Expectation{Name: "foo.example.org", Type: dns.TypeA, Target: "192.0.2.1"}
+
+	ctx, cancel := testContext()
+	defer cancel()
+
+	report := checker.Check(ctx, expected)
+	failed := report.Failed()
+	if len(failed) != 1 || failed[0].Resolver.Name != "stale" {
+		t.Fatalf("expected only the stale resolver to fail, got:\n%s", report)
+	}
+
+	if failed[0].Status != StatusNXDomain || failed[0].NegativeTTL != 60 {
+		t.Errorf("expected a cached NXDOMAIN, got: %s", failed[0])
+	}
+
+	err := report.Err()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, expected := range []string{"foo.example.org. A 192.0.2.1 not propagated to 1 of 2 resolvers", "stale (127.0.0.1:", "nxdomain", "cached for up to 60s"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in the error:\n%v", expected, err)
+		}
+	}
+
+	// the record propagates while waiting
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		stale.setRecords("foo.example.org. 60 IN A 192.0.2.1")
+	}()
+
+	report, err = checker.Wait(ctx, expected, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Failed()) != 0 {
+		t.Errorf("expected all resolvers to return the record, got:\n%s", report)
+	}
+}
+
+// newSilentResolver returns a resolver which never answers, and the socket
+// to close after the test.
+func newSilentResolver(t *testing.T) (Resolver, io.Closer) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Resolver{Address: conn.LocalAddr().String()}, conn
+}
+
+// isTimeout tells whether the error is the one of an expired context or a
+// timed out query.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func TestWaitTimeout(t *testing.T) {
+	resolver, conn := newSilentResolver(t)
+	defer conn.Close()
+
+	// the queries run with the default timeout of the client, so only the
+	// deadline of the context ends them, whenever the scheduler runs the
+	// checks
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	report, err := NewChecker([]Resolver{resolver}).Wait(ctx, Expectation{Name: "foo.example.org", Type: dns.TypeA}, 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline of the context, got: %v", err)
+	}
+
+	if report == nil {
+		t.Fatal("expected the last report")
+	}
+
+	if result := report.Results[0]; result.Status != StatusError || !isTimeout(result.Err) {
+		t.Errorf("expected a timed out query, got: %s", result)
+	}
+}
+
+func TestCheckUnreachableResolver(t *testing.T) {
+	resolver, conn := newSilentResolver(t)
+	defer conn.Close()
+
+	checker := NewChecker([]Resolver{resolver})
+	checker.Client.Timeout = 50 * time.Millisecond
+
+	ctx, cancel := testContext()
+	defer cancel()
+
+	report := checker.Check(ctx, Expectation{Name: "foo.example.org", Type: dns.TypeA})
+	if result := report.Results[0]; result.Status != StatusError || !isTimeout(result.Err) {
+		t.Errorf("expected a timed out query, got: %s", result)
+	}
+}
+
+func TestCheckExpiredContext(t *testing.T) {
+	resolver, conn := newSilentResolver(t)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report := NewChecker([]Resolver{resolver}).Check(ctx, Expectation{Name: "foo.example.org", Type: dns.TypeA})
+	if result := report.Results[0]; result.Status != StatusError || !errors.Is(result.Err, context.Canceled) {
+		t.Errorf("expected the error of the context, got: %s", result)
+	}
+}
+
+func TestAuthoritativeResolvers(t *testing.T) {
+	server := newTestServer(t,
+		"example.org. 172800 IN NS ns1.example.org.",
+		"example.org. 172800 IN NS ns2.example.net.",
+		"ns1.example.org. 172800 IN A 127.0.0.1",
+		"ns2.example.net. 172800 IN A 127.0.0.2",
+	)
+	defer server.close()
+
+	_, port, err := net.SplitHostPort(server.resolver("").Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaultPort := nameserverPort
+	nameserverPort = port
+	defer func() { nameserverPort = defaultPort }()
+
+	ctx, cancel := testContext()
+	defer cancel()
+
+	resolvers, err := AuthoritativeResolvers(ctx, nil, server.resolver("system"), "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Resolver{
+		{Name: "ns1.example.org", Address: "127.0.0.1:" + port},
+		{Name: "ns2.example.net", Address: "127.0.0.2:" + port},
+	}
+	if !reflect.DeepEqual(resolvers, expected) {
+		t.Errorf("expected resolvers %v, got %v", expected, resolvers)
+	}
+
+	if _, err := AuthoritativeResolvers(ctx, nil, server.resolver("system"), "missing.org"); err == nil {
+		t.Error("expected an error for a missing zone")
+	}
+}
+
+func TestSystemResolvers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnscheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	if err := ioutil.WriteFile(resolvConf, []byte("search example.org\nnameserver 10.0.0.10\nnameserver 10.0.0.11\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resolvers, err := SystemResolvers(resolvConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Resolver{{Name: "system", Address: "10.0.0.10:53"}, {Name: "system", Address: "10.0.0.11:53"}}
+	if !reflect.DeepEqual(resolvers, expected) {
+		t.Errorf("expected resolvers %v, got %v", expected, resolvers)
+	}
+}
+
+func TestParseResolvers(t *testing.T) {
+	resolvers, err := ParseResolvers(context.Background(), nil, "8.8.8.8, 127.0.0.1:5353,[2001:db8::1]:53", "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Resolver{{Address: "8.8.8.8:53"}, {Address: "127.0.0.1:5353"}, {Address: "[2001:db8::1]:53"}}
+	if !reflect.DeepEqual(resolvers, expected) {
+		t.Errorf("expected resolvers %v, got %v", expected, resolvers)
+	}
+
+	if _, err := ParseResolvers(context.Background(), nil, " ", "example.org"); err == nil {
+		t.Error("expected an error without resolvers")
+	}
+}
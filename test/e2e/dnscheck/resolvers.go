@@ -0,0 +1,212 @@
+package dnscheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// ResolversSystem selects the nameservers of resolv.conf.
+	ResolversSystem = "system"
+
+	// ResolversAuthoritative selects the nameservers of the zone.
+	ResolversAuthoritative = "authoritative"
+
+	// ResolvConf is the configuration of the system resolvers.
+	ResolvConf = "/etc/resolv.conf"
+)
+
+// nameserverPort is the port of the authoritative nameservers, changed by
+// the tests.
+var nameserverPort = "53"
+
+// Resolver is a nameserver queried by the checks.
+type Resolver struct {
+	// Name describes the resolver in the reports, e.g. system or the name
+	// of a nameserver.
+	Name string
+
+	// Address is the host:port of the nameserver.
+	Address string
+}
+
+func (r Resolver) String() string {
+	if r.Name == "" || r.Name == r.Address {
+		return r.Address
+	}
+
+	return fmt.Sprintf("%s (%s)", r.Name, r.Address)
+}
+
+// SystemResolvers returns the nameservers of the resolv.conf file.
+func SystemResolvers(resolvConf string) ([]Resolver, error) {
+	config, err := dns.ClientConfigFromFile(resolvConf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Servers) == 0 {
+		return nil, fmt.Errorf("no nameservers in %s", resolvConf)
+	}
+
+	resolvers := make([]Resolver, 0, len(config.Servers))
+	for _, server := range config.Servers {
+		resolvers = append(resolvers, Resolver{Name: ResolversSystem, Address: net.JoinHostPort(server, config.Port)})
+	}
+
+	return resolvers, nil
+}
+
+// AuthoritativeResolvers returns the nameservers of the zone, looked up with
+// the resolver. The client may be nil for the default settings.
+func AuthoritativeResolvers(ctx context.Context, client *dns.Client, via Resolver, zone string) ([]Resolver, error) {
+	rsp, err := exchange(ctx, client, via, zone, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("failed to look up the nameservers of %s at %s: %s", zone, via, dns.RcodeToString[rsp.Rcode])
+	}
+
+	// the addresses of the nameservers are often in the additional section
+	glue := make(map[string][]string)
+	for _, rr := range rsp.Extra {
+		if a, ok := rr.(*dns.A); ok {
+			name := strings.ToLower(a.Hdr.Name)
+			glue[name] = append(glue[name], a.A.String())
+		}
+	}
+
+	var resolvers []Resolver
+	for _, rr := range rsp.Answer {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		name := strings.ToLower(ns.Ns)
+		addresses, ok := glue[name]
+		if !ok {
+			addresses, err = lookupAddresses(ctx, client, via, name, dns.TypeA)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, address := range addresses {
+			resolvers = append(resolvers, Resolver{Name: strings.TrimSuffix(name, "."), Address: net.JoinHostPort(address, nameserverPort)})
+		}
+	}
+
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("no nameservers found for %s at %s", zone, via)
+	}
+
+	return resolvers, nil
+}
+
+// ParseResolvers returns the resolvers selected by a comma separated list of
+// system, authoritative, or the addresses of nameservers, with port 53 by
+// default. The authoritative nameservers of the zone are looked up with the
+// system resolvers.
+func ParseResolvers(ctx context.Context, client *dns.Client, list, zone string) ([]Resolver, error) {
+	var resolvers []Resolver
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		switch item {
+		case "":
+		case ResolversSystem, ResolversAuthoritative:
+			system, err := SystemResolvers(ResolvConf)
+			if err != nil {
+				return nil, err
+			}
+
+			if item == ResolversSystem {
+				resolvers = append(resolvers, system...)
+				continue
+			}
+
+			authoritative, err := AuthoritativeResolvers(ctx, client, system[0], zone)
+			if err != nil {
+				return nil, err
+			}
+
+			resolvers = append(resolvers, authoritative...)
+		default:
+			address := item
+			if _, _, err := net.SplitHostPort(item); err != nil {
+				address = net.JoinHostPort(item, "53")
+			}
+
+			resolvers = append(resolvers, Resolver{Address: address})
+		}
+	}
+
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("no resolvers selected by %q", list)
+	}
+
+	return resolvers, nil
+}
+
+func exchange(ctx context.Context, client *dns.Client, r Resolver, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.SetEdns0(4096, false)
+
+	if client == nil {
+		client = &dns.Client{Timeout: defaultTimeout}
+	}
+
+	fail := func(err error) (*dns.Msg, error) {
+		return nil, fmt.Errorf("failed to query %s %s at %s: %w", name, dns.TypeToString[qtype], r, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+
+	// the client is copied with the deadline of the context as its timeout,
+	// since ExchangeContext changes the client and can't be used concurrently
+	timeout := client.Timeout
+	if deadline, ok := ctx.Deadline(); ok && (timeout == 0 || time.Until(deadline) < timeout) {
+		// a zero timeout would be the default one of the client
+		timeout = time.Until(deadline)
+		if timeout <= 0 {
+			return fail(context.DeadlineExceeded)
+		}
+	}
+
+	query := &dns.Client{Net: client.Net, UDPSize: client.UDPSize, TLSConfig: client.TLSConfig, Timeout: timeout}
+	rsp, _, err := query.Exchange(m, r.Address)
+	if err != nil {
+		return fail(err)
+	}
+
+	return rsp, nil
+}
+
+// lookupAddresses returns the addresses of the name at the resolver.
+func lookupAddresses(ctx context.Context, client *dns.Client, r Resolver, name string, qtype uint16) ([]string, error) {
+	rsp, err := exchange(ctx, client, r, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("failed to resolve %s at %s: %s", name, r, dns.RcodeToString[rsp.Rcode])
+	}
+
+	addresses := recordValues(rsp.Answer, qtype)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no %s records of %s at %s", dns.TypeToString[qtype], name, r)
+	}
+
+	return addresses, nil
+}
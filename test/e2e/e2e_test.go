@@ -20,8 +20,11 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/clusterconfig"
 	"k8s.io/kubernetes/test/e2e"
 	"k8s.io/kubernetes/test/e2e/framework"
 	"k8s.io/kubernetes/test/e2e/framework/config"
@@ -128,3 +131,53 @@ func E2ES3AWSIAMBucket() string {
 func E2EAWSIAMRole() string {
 	return getenv("AWS_IAM_ROLE", "")
 }
+
+// E2EAuthorizationMatrixDir returns the directory of the authorization test
+// matrix files.
+func E2EAuthorizationMatrixDir() string {
+	return getenv("AUTHORIZATION_MATRIX_DIR", "authz/matrix")
+}
+
+// E2EDNSResolvers returns the resolvers checked for the DNS records of the
+// tests: system, authoritative for the nameservers of the hosted zone, or the
+// addresses of nameservers, separated by commas.
+func E2EDNSResolvers() string {
+	return getenv("DNS_RESOLVERS", "authoritative")
+}
+
+// E2EClusterDir returns the directory of the cluster configuration, which
+// holds the audit policy of the masters.
+func E2EClusterDir() string {
+	return getenv("CLUSTER_DIR", "../../cluster")
+}
+
+// E2EIngressSSLPolicy returns the ELB security policy of the ingress load
+// balancers, kube_aws_ingress_controller_ssl_policy of the config defaults
+// unless INGRESS_SSL_POLICY is set.
+func E2EIngressSSLPolicy() (string, error) {
+	if result, ok := os.LookupEnv("INGRESS_SSL_POLICY"); ok {
+		return result, nil
+	}
+
+	config, err := clusterconfig.E2EClusterConfig().WithDefaults(filepath.Join(E2EClusterDir(), "config-defaults.yaml"))
+	if err != nil {
+		return "", fmt.Errorf("failed to load the config defaults: %v", err)
+	}
+	return config.ConfigItems["kube_aws_ingress_controller_ssl_policy"], nil
+}
+
+// E2EAuthorizationConcurrency returns the number of access reviews executed
+// in parallel by the authorization test.
+func E2EAuthorizationConcurrency() int {
+	result, err := strconv.Atoi(getenv("AUTHORIZATION_TEST_CONCURRENCY", "16"))
+	if err != nil || result < 1 {
+		panic("invalid AUTHORIZATION_TEST_CONCURRENCY")
+	}
+	return result
+}
+
+// E2EAuthorizationImpersonate returns whether the authorization test cases
+// are also sent as real, impersonated requests.
+func E2EAuthorizationImpersonate() bool {
+	return getenv("AUTHORIZATION_TEST_IMPERSONATE", "false") == "true"
+}
@@ -75,6 +75,14 @@ var _ = framework.KubeDescribe("External DNS creation", func() {
 		framework.ExpectNoError(f.WaitForPodRunning(pod.Name))
 
 		timeout := 10 * time.Minute
+		By("Waiting up to " + timeout.String() + " for the load balancer of service " + serviceName)
+		loadBalancer, err := waitForServiceLoadBalancer(cs, ns, serviceName, timeout)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Waiting up to " + timeout.String() + " for the record of " + hostName + " pointing to " + loadBalancer)
+		err = waitForDNSRecord(hostName, loadBalancer, timeout)
+		Expect(err).NotTo(HaveOccurred())
+
 		// wait for DNS and for pod to be reachable.
 		By("Waiting up to " + timeout.String() + " for " + hostName + " to be reachable")
 		err = waitForSuccessfulResponse(hostName, timeout)
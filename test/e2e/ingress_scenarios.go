@@ -0,0 +1,446 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/probe"
+	"k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	"k8s.io/kubernetes/test/e2e/framework/ingress"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	loadBalancerTypeAnnotation = "zalando.org/aws-load-balancer-type"
+
+	// hostPlaceholder is replaced with the hostname of the ingress or the
+	// route group in the annotations, the filters and the expected locations
+	// of the scenarios.
+	hostPlaceholder = "$host"
+
+	// namespacePlaceholder is replaced with the namespace of the backends
+	// in the addresses of network backends.
+	namespacePlaceholder = "$namespace"
+
+	ingressScenarioPort       = 8080
+	ingressScenarioTargetPort = 9090
+
+	// ingressScenarioTimeout is how long a request of a scenario is retried
+	// while the routes of the ingress change propagate.
+	ingressScenarioTimeout = time.Minute
+)
+
+// ingressBackend is a skipper deployment answering every request with its
+// content, and its service.
+type ingressBackend struct {
+	service string
+	content string
+}
+
+var (
+	skipperBackend  = ingressBackend{service: "skipper-ingress-test", content: "be-foo"}
+	skipperBackend2 = ingressBackend{service: "skipper-ingress-test2", content: "be-bar"}
+)
+
+// ingressPath routes a path of the ingress to the service of a backend.
+type ingressPath struct {
+	path    string
+	service string
+}
+
+// ingressRequest is a request sent in a scenario, and its expected response.
+// The route group scenarios send the same requests.
+type ingressRequest struct {
+	// host is the prefix of one of the additional hostnames of the
+	// scenario, or empty for the hostname of the ingress
+	host    string
+	method  string
+	path    string
+	headers map[string]string
+
+	status          int
+	responseHeaders map[string]string
+	body            string
+
+	// bodies are the bodies all expected to be served by repeating the
+	// request, e.g. by weighted backends, instead of body
+	bodies []string
+
+	// location is the expected Location of a redirect
+	location string
+}
+
+// ingressScenario is a version of the ingress of the shared backends, and the
+// requests expected to be routed according to it.
+type ingressScenario struct {
+	name        string
+	annotations map[string]string
+
+	// paths are the paths of the ingress, / to skipperBackend when empty
+	paths []ingressPath
+
+	// hosts are the prefixes of additional hostnames of the ingress in the
+	// hosted zone
+	hosts []string
+
+	requests []ingressRequest
+}
+
+// skipperIngressScenarios check the features of skipper configured with the
+// annotations of the ingresses.
+var skipperIngressScenarios = []ingressScenario{{
+	name: "default route",
+	requests: []ingressRequest{
+		{status: http.StatusOK, body: skipperBackend.content},
+	},
+}, {
+	name:        "predicate matching the request",
+	annotations: map[string]string{"zalando.org/skipper-predicate": `Method("GET")`},
+	requests: []ingressRequest{
+		{status: http.StatusOK, body: skipperBackend.content},
+	},
+}, {
+	name:        "predicate not matching the request",
+	annotations: map[string]string{"zalando.org/skipper-predicate": `Method("PUT")`},
+	requests: []ingressRequest{
+		{status: http.StatusNotFound},
+		{method: http.MethodPut, status: http.StatusOK, body: skipperBackend.content},
+	},
+}, {
+	name:        "filter",
+	annotations: map[string]string{"zalando.org/skipper-filter": `setResponseHeader("X-Foo", "f00")`},
+	requests: []ingressRequest{
+		{status: http.StatusOK, responseHeaders: map[string]string{"X-Foo": "f00"}, body: skipperBackend.content},
+	},
+}, {
+	name:  "additional hostname",
+	hosts: []string{"foo"},
+	requests: []ingressRequest{
+		{host: "foo", status: http.StatusOK, body: skipperBackend.content},
+		{status: http.StatusOK, body: skipperBackend.content},
+	},
+}, {
+	name:  "path",
+	paths: []ingressPath{{path: "/foo", service: skipperBackend.service}},
+	requests: []ingressRequest{
+		{path: "/foo", status: http.StatusOK, body: skipperBackend.content},
+		{path: "/", status: http.StatusNotFound},
+		{path: "/bar", status: http.StatusNotFound},
+	},
+}, {
+	name: "paths of different backends",
+	paths: []ingressPath{
+		{path: "/foo", service: skipperBackend.service},
+		{path: "/bar", service: skipperBackend2.service},
+	},
+	requests: []ingressRequest{
+		{path: "/bar", status: http.StatusOK, body: skipperBackend2.content},
+		{path: "/foo", status: http.StatusOK, body: skipperBackend.content},
+	},
+}, {
+	name: "custom route",
+	annotations: map[string]string{
+		"zalando.org/skipper-routes": `redirecttoself: PathRegexp("/redirect") -> modPath("/redirect", "/") -> redirectTo(307, "https://$host/") -> <shunt>;`,
+	},
+	requests: []ingressRequest{
+		{path: "/redirect", status: http.StatusTemporaryRedirect, location: "https://$host/"},
+		{status: http.StatusOK, body: skipperBackend.content},
+	},
+}}
+
+var _ = framework.KubeDescribe("Skipper ingress annotations", func() {
+	f := framework.NewDefaultFramework("skipper-ingress")
+
+	It("Should route according to the skipper annotations of the ingress [Ingress] [Zalando]", func() {
+		deploySkipperBackends(f, skipperBackend, skipperBackend2)
+		runner := newIngressScenarioRunner(f, nil)
+		defer runner.close()
+
+		for _, scenario := range skipperIngressScenarios {
+			runner.run(scenario)
+		}
+	})
+})
+
+// deploySkipperBackends creates the deployments and the services of the
+// backends of the scenarios.
+func deploySkipperBackends(f *framework.Framework, backends ...ingressBackend) {
+	cs := f.ClientSet
+	ns := f.Namespace.Name
+
+	for _, backend := range backends {
+		labels := map[string]string{"app": backend.service}
+		route := fmt.Sprintf(`* -> inlineContent("%s") -> <shunt>`, backend.content)
+
+		By("Creating a deployment with " + backend.service + " in namespace " + ns)
+		depl := createSkipperBackendDeployment(backend.service, ns, route, labels, ingressScenarioTargetPort, 3)
+		_, err := cs.AppsV1().Deployments(ns).Create(depl)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("Creating service " + backend.service + " in namespace " + ns)
+		service := createServiceTypeClusterIP(backend.service, labels, ingressScenarioPort, ingressScenarioTargetPort)
+		_, err = cs.CoreV1().Services(ns).Create(service)
+		Expect(err).NotTo(HaveOccurred())
+	}
+}
+
+// scenarioClient sends the requests of the scenarios to a hostname, and to
+// the additional hostnames of the scenarios.
+type scenarioClient struct {
+	namespace string
+	hostName  string
+	created   int64
+
+	rt   http.RoundTripper
+	quit chan<- struct{}
+
+	// resolved are the hostnames known to be resolvable
+	resolved map[string]bool
+}
+
+func newScenarioClient(namespace, name string) *scenarioClient {
+	created := time.Now().UTC().Unix()
+	return &scenarioClient{
+		namespace: namespace,
+		hostName:  fmt.Sprintf("%s-%d.%s", name, created, E2EHostedZone()),
+		created:   created,
+		resolved:  make(map[string]bool),
+	}
+}
+
+// start creates the round tripper of the requests, once the hostname
+// resolves.
+func (c *scenarioClient) start() {
+	c.resolved[c.hostName] = true
+	c.rt, c.quit = createHTTPRoundTripper()
+}
+
+func (c *scenarioClient) close() {
+	c.quit <- struct{}{}
+}
+
+// host returns the hostname of an additional host of the scenarios, or the
+// main hostname.
+func (c *scenarioClient) host(prefix string) string {
+	if prefix == "" {
+		return c.hostName
+	}
+
+	return fmt.Sprintf("%s-%d.%s", prefix, c.created, E2EHostedZone())
+}
+
+func (c *scenarioClient) hosts(prefixes []string) []string {
+	var hostnames []string
+	for _, prefix := range prefixes {
+		hostnames = append(hostnames, c.host(prefix))
+	}
+
+	return hostnames
+}
+
+func (c *scenarioClient) expand(s string) string {
+	s = strings.Replace(s, hostPlaceholder, c.hostName, -1)
+	return strings.Replace(s, namespacePlaceholder, c.namespace, -1)
+}
+
+// waitForHosts waits for the additional hostnames to resolve.
+func (c *scenarioClient) waitForHosts(prefixes []string) {
+	for _, hostname := range c.hosts(prefixes) {
+		if c.resolved[hostname] {
+			continue
+		}
+
+		By("Waiting for new DNS hostname to be resolvable " + hostname)
+		err := waitForResponse(hostname, "https", 10*time.Minute, probe.StatusMatches("any response", func(int) bool { return true }), false)
+		Expect(err).NotTo(HaveOccurred())
+		c.resolved[hostname] = true
+	}
+}
+
+// expect sends the request until it gets the expected response.
+func (c *scenarioClient) expect(scenario string, request ingressRequest) {
+	method := request.method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	path := request.path
+	if path == "" {
+		path = "/"
+	}
+
+	url := "https://" + c.host(request.host) + path
+	req, err := http.NewRequest(method, url, nil)
+	Expect(err).NotTo(HaveOccurred())
+
+	for k, v := range request.headers {
+		req.Header.Set(k, v)
+	}
+
+	expectations := []probe.Expectation{probe.StatusCode(request.status)}
+	for k, v := range request.responseHeaders {
+		expectations = append(expectations, probe.Header(k, v))
+	}
+
+	if request.body != "" {
+		expectations = append(expectations, probe.BodyEquals(request.body))
+	}
+
+	if len(request.bodies) > 0 {
+		expectations = append(expectations, bodiesServed(request.bodies))
+	}
+
+	if request.location != "" {
+		expectations = append(expectations, probe.Header("Location", c.expand(request.location)))
+	}
+
+	By(fmt.Sprintf("Scenario %q: expecting %s %s to respond with %d", scenario, method, url, request.status))
+	p := probe.New(c.rt)
+	p.Backoff = probe.Backoff{Initial: time.Second, Max: time.Second}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ingressScenarioTimeout)
+	defer cancel()
+
+	_, err = p.Do(ctx, req, expectations...)
+	Expect(err).NotTo(HaveOccurred())
+}
+
+// bodiesServed is met once every body has been served by one of the
+// responses it checked.
+func bodiesServed(bodies []string) probe.Expectation {
+	served := make(map[string]bool)
+	return probe.Expect(fmt.Sprintf("bodies %q served", bodies), func(_ *http.Response, body []byte) error {
+		served[string(body)] = true
+
+		var missing []string
+		for _, b := range bodies {
+			if !served[b] {
+				missing = append(missing, b)
+			}
+		}
+
+		if len(missing) > 0 {
+			return fmt.Errorf("bodies %q not served yet", missing)
+		}
+
+		return nil
+	})
+}
+
+// ingressScenarioRunner runs the scenarios against one ingress, with a load
+// balancer and a hostname shared by all of them.
+type ingressScenarioRunner struct {
+	*scenarioClient
+
+	cs          kubernetes.Interface
+	name        string
+	labels      map[string]string
+	annotations map[string]string
+}
+
+// newIngressScenarioRunner creates an ingress for skipperBackend with the
+// annotations of the load balancer, once the backends are deployed. It waits
+// for the load balancer and the hostname to be ready.
+func newIngressScenarioRunner(f *framework.Framework, annotations map[string]string) *ingressScenarioRunner {
+	cs := f.ClientSet
+	ns := f.Namespace.Name
+	waitTime := 10 * time.Minute
+
+	r := &ingressScenarioRunner{
+		scenarioClient: newScenarioClient(ns, skipperBackend.service),
+		cs:             cs,
+		labels:         map[string]string{"app": skipperBackend.service},
+		annotations:    annotations,
+	}
+
+	By("Creating ingress " + skipperBackend.service + " in namespace " + ns + " with hostname " + r.hostName)
+	ing := createIngress(skipperBackend.service, r.hostName, ns, r.labels, annotations, ingressScenarioPort)
+	ingressCreate, err := cs.NetworkingV1beta1().Ingresses(ns).Create(ing)
+	Expect(err).NotTo(HaveOccurred())
+	r.name = ingressCreate.Name
+
+	addr, err := ingress.NewIngressTestJig(cs).WaitForIngressAddress(cs, ns, r.name, waitTime)
+	Expect(err).NotTo(HaveOccurred())
+
+	_, err = cs.NetworkingV1beta1().Ingresses(ns).Get(r.name, metav1.GetOptions{ResourceVersion: "0"})
+	Expect(err).NotTo(HaveOccurred())
+
+	// the NLBs only listen on https
+	if annotations[loadBalancerTypeAnnotation] != "nlb" {
+		By("Waiting for skipper route to default redirect from http to https, to see that our ingress-controller and skipper works")
+		err = waitForResponse(addr, "http", waitTime, isRedirect, true)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	By("Waiting for the load balancer to create endpoint " + addr + " and skipper route, to see that our ingress-controller and skipper works")
+	err = waitForResponse(addr, "https", waitTime, isNotFound, true)
+	Expect(err).NotTo(HaveOccurred())
+
+	By("Waiting for DNS to see that external-dns and skipper route to service and pod works")
+	err = waitForResponse(r.hostName, "https", waitTime, isSuccess, false)
+	Expect(err).NotTo(HaveOccurred())
+
+	r.start()
+	return r
+}
+
+// ingress returns the ingress of the scenario.
+func (r *ingressScenarioRunner) ingress(s ingressScenario) *v1beta1.Ingress {
+	annotations := make(map[string]string)
+	for k, v := range r.annotations {
+		annotations[k] = v
+	}
+
+	for k, v := range s.annotations {
+		annotations[k] = r.expand(v)
+	}
+
+	paths := s.paths
+	if len(paths) == 0 {
+		paths = []ingressPath{{path: "/", service: skipperBackend.service}}
+	}
+
+	ing := updateIngress(r.name, r.namespace, r.hostName, paths[0].service, paths[0].path, r.labels, annotations, ingressScenarioPort)
+	for _, p := range paths[1:] {
+		ing = addPathIngress(ing, p.path, v1beta1.IngressBackend{
+			ServiceName: p.service,
+			ServicePort: intstr.FromInt(ingressScenarioPort),
+		})
+	}
+
+	return addHostIngress(ing, r.hosts(s.hosts)...)
+}
+
+// run updates the ingress to the scenario, and sends its requests until they
+// get the expected responses.
+func (r *ingressScenarioRunner) run(s ingressScenario) {
+	By(fmt.Sprintf("Updating ingress %s/%s for the scenario %q", r.namespace, r.name, s.name))
+	_, err := r.cs.NetworkingV1beta1().Ingresses(r.namespace).Update(r.ingress(s))
+	Expect(err).NotTo(HaveOccurred())
+
+	r.waitForHosts(s.hosts)
+	for _, request := range s.requests {
+		r.expect(s.name, request)
+	}
+}
+
+// lookupIngressScenario returns the skipper ingress scenario with the name.
+func lookupIngressScenario(name string) ingressScenario {
+	for _, s := range skipperIngressScenarios {
+		if s.name == name {
+			return s
+		}
+	}
+
+	framework.Failf("unknown ingress scenario %q", name)
+	return ingressScenario{}
+}
@@ -0,0 +1,34 @@
+package e2e
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/tlscheck"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+
+	. "github.com/onsi/ginkgo"
+)
+
+// expectIngressTLS inspects the TLS served for the hostname of an ingress and
+// expects a valid certificate for it, and the protocol versions and cipher
+// suites of the SSL policy of the ingress controller.
+func expectIngressTLS(hostname string) {
+	policyName, err := E2EIngressSSLPolicy()
+	framework.ExpectNoError(err, "failed to resolve the SSL policy of the ingress controller")
+
+	By("Checking that the TLS of " + hostname + " matches the SSL policy " + policyName)
+	policy, err := tlscheck.LookupSecurityPolicy(policyName)
+	framework.ExpectNoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	inspection, err := tlscheck.NewInspector().Inspect(ctx, net.JoinHostPort(hostname, "443"), hostname)
+	framework.ExpectNoError(err, "failed to inspect the TLS of %s", hostname)
+
+	e2elog.Logf("TLS of %s:\n%s", hostname, inspection)
+	framework.ExpectNoError(inspection.Check(policy))
+}
@@ -0,0 +1,80 @@
+package probe
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+)
+
+// ErrorClass is the kind of failure of an attempt.
+type ErrorClass string
+
+const (
+	// ClassNone is a successful attempt.
+	ClassNone ErrorClass = ""
+
+	// ClassDNS is a failed name resolution, e.g. a record which hasn't
+	// propagated yet.
+	ClassDNS ErrorClass = "dns"
+
+	// ClassDial is a failed connection, e.g. a refused one.
+	ClassDial ErrorClass = "dial"
+
+	// ClassTLS is a failed handshake or an untrusted certificate.
+	ClassTLS ErrorClass = "tls"
+
+	// ClassTimeout is an attempt which didn't complete in time.
+	ClassTimeout ErrorClass = "timeout"
+
+	// ClassExpectation is a response which didn't match the expectations.
+	ClassExpectation ErrorClass = "expectation"
+
+	// ClassOther is any other failure.
+	ClassOther ErrorClass = "other"
+)
+
+// Classify returns the class of the error of a request.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ClassNone
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ClassDNS
+	}
+
+	if isTLSError(err) {
+		return ClassTLS
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ClassDial
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ClassTimeout
+	}
+
+	return ClassOther
+}
+
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalid) {
+		return true
+	}
+
+	// the alerts and the handshake timeout of the tls package and of the
+	// transport don't have exported types
+	msg := err.Error()
+	return strings.Contains(msg, "tls: ") || strings.Contains(msg, "TLS handshake")
+}
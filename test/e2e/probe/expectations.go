@@ -0,0 +1,128 @@
+package probe
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Expectation is a condition on the response of a probe. The body has
+// already been read from the response.
+type Expectation interface {
+	// Check returns why the response doesn't match the expectation, or nil
+	// when it does.
+	Check(rsp *http.Response, body []byte) error
+
+	String() string
+}
+
+type expectation struct {
+	description string
+	check       func(rsp *http.Response, body []byte) error
+}
+
+func (e expectation) Check(rsp *http.Response, body []byte) error {
+	return e.check(rsp, body)
+}
+
+func (e expectation) String() string {
+	return e.description
+}
+
+// Expect creates an expectation from a function. The description is used in
+// the failure output.
+func Expect(description string, check func(rsp *http.Response, body []byte) error) Expectation {
+	return expectation{description: description, check: check}
+}
+
+// StatusCode expects one of the status codes.
+func StatusCode(codes ...int) Expectation {
+	description := fmt.Sprintf("status %v", codes)
+	if len(codes) == 1 {
+		description = fmt.Sprintf("status %d", codes[0])
+	}
+
+	return Expect(description, func(rsp *http.Response, _ []byte) error {
+		for _, code := range codes {
+			if rsp.StatusCode == code {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("expected %s, got %d", description, rsp.StatusCode)
+	})
+}
+
+// StatusMatches expects a status code for which the predicate is true, e.g.
+// any redirect.
+func StatusMatches(description string, predicate func(code int) bool) Expectation {
+	return Expect(description, func(rsp *http.Response, _ []byte) error {
+		if !predicate(rsp.StatusCode) {
+			return fmt.Errorf("expected %s, got status %d", description, rsp.StatusCode)
+		}
+
+		return nil
+	})
+}
+
+// Header expects the value of a response header.
+func Header(key, value string) Expectation {
+	description := fmt.Sprintf("header %s: %s", key, value)
+	return Expect(description, func(rsp *http.Response, _ []byte) error {
+		if values, ok := rsp.Header[http.CanonicalHeaderKey(key)]; !ok {
+			return fmt.Errorf("expected %s, the header is missing", description)
+		} else if actual := rsp.Header.Get(key); actual != value {
+			return fmt.Errorf("expected %s, got %q", description, values)
+		}
+
+		return nil
+	})
+}
+
+// BodyEquals expects the exact response body.
+func BodyEquals(content string) Expectation {
+	description := fmt.Sprintf("body %q", truncate(content))
+	return Expect(description, func(_ *http.Response, body []byte) error {
+		if string(body) != content {
+			return fmt.Errorf("expected %s, got %q", description, truncate(string(body)))
+		}
+
+		return nil
+	})
+}
+
+// BodyContains expects the response body to contain a string.
+func BodyContains(content string) Expectation {
+	description := fmt.Sprintf("body containing %q", truncate(content))
+	return Expect(description, func(_ *http.Response, body []byte) error {
+		if !strings.Contains(string(body), content) {
+			return fmt.Errorf("expected %s, got %q", description, truncate(string(body)))
+		}
+
+		return nil
+	})
+}
+
+// BodyMatches expects the response body to match a regular expression.
+func BodyMatches(re *regexp.Regexp) Expectation {
+	description := fmt.Sprintf("body matching %s", re)
+	return Expect(description, func(_ *http.Response, body []byte) error {
+		if !re.Match(body) {
+			return fmt.Errorf("expected %s, got %q", description, truncate(string(body)))
+		}
+
+		return nil
+	})
+}
+
+// maxBodyOutput is the length of the bodies shown in the failures.
+const maxBodyOutput = 80
+
+func truncate(s string) string {
+	if len(s) <= maxBodyOutput {
+		return s
+	}
+
+	return s[:maxBodyOutput] + "..."
+}
@@ -0,0 +1,277 @@
+// Package probe waits for HTTP endpoints to respond as expected, e.g. for an
+// ingress to be routed or a DNS record to be propagated. Probes are bounded
+// by the deadline of a context, retried with a backoff, and report the last
+// attempts when they fail.
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAttemptTimeout = 10 * time.Second
+	defaultHistory        = 5
+
+	// maxBodySize is the maximum size of the bodies read by the probes.
+	maxBodySize = 1 << 20
+)
+
+// DefaultBackoff is the backoff of the probers created with New.
+var DefaultBackoff = Backoff{Initial: time.Second, Max: 10 * time.Second, Factor: 2}
+
+// Backoff is the delay between the attempts of a probe. It starts at
+// Initial, and is multiplied by Factor after every attempt up to Max.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+func (b Backoff) next(delay time.Duration) time.Duration {
+	if delay == 0 {
+		delay = b.Initial
+	} else if b.Factor > 1 {
+		delay = time.Duration(float64(delay) * b.Factor)
+	}
+
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+
+	return delay
+}
+
+// Attempt is a single request of a probe.
+type Attempt struct {
+	Start   time.Time
+	Latency time.Duration
+
+	// Status is the status code of the response, 0 when the request failed.
+	Status int
+
+	Class ErrorClass
+	Err   error
+}
+
+func (a Attempt) String() string {
+	var status string
+	if a.Status != 0 {
+		status = fmt.Sprintf("status %d", a.Status)
+	} else {
+		status = "no response"
+	}
+
+	if a.Err == nil {
+		return fmt.Sprintf("%s, %s", status, a.Latency)
+	}
+
+	return fmt.Sprintf("%s, %s, %s: %v", status, a.Latency, a.Class, a.Err)
+}
+
+// Error is the failure of a probe, with the last attempts.
+type Error struct {
+	URL          string
+	Expectations []Expectation
+	Elapsed      time.Duration
+	NumAttempts  int
+
+	// Attempts are the last attempts, the oldest first.
+	Attempts []Attempt
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s didn't respond as expected after %d attempts in %s", e.URL, e.NumAttempts, e.Elapsed.Round(time.Millisecond))
+	if len(e.Expectations) > 0 {
+		expectations := make([]string, 0, len(e.Expectations))
+		for _, expectation := range e.Expectations {
+			expectations = append(expectations, expectation.String())
+		}
+
+		fmt.Fprintf(&b, " (expected %s)", strings.Join(expectations, ", "))
+	}
+
+	if len(e.Attempts) > 0 {
+		fmt.Fprintf(&b, ", last %d attempts:", len(e.Attempts))
+	}
+
+	first := e.NumAttempts - len(e.Attempts) + 1
+	for i, attempt := range e.Attempts {
+		fmt.Fprintf(&b, "\n  #%d at %s: %s", first+i, attempt.Start.UTC().Format("15:04:05.000"), attempt)
+	}
+
+	return b.String()
+}
+
+// LastClass returns the class of the error of the last attempt.
+func (e *Error) LastClass() ErrorClass {
+	if len(e.Attempts) == 0 {
+		return ClassNone
+	}
+
+	return e.Attempts[len(e.Attempts)-1].Class
+}
+
+// Prober sends requests until the response matches the expectations.
+type Prober struct {
+	// Client sends the requests. Unless it's changed, the redirects are
+	// not followed, so that they can be expected.
+	Client *http.Client
+
+	Backoff Backoff
+
+	// AttemptTimeout bounds every attempt, including reading the body.
+	AttemptTimeout time.Duration
+
+	// History is the number of attempts reported on failures.
+	History int
+}
+
+// New creates a prober sending the requests with the round tripper. When
+// it's nil, a transport without keep-alives is used, so that every attempt
+// resolves the name and connects again.
+func New(rt http.RoundTripper) *Prober {
+	if rt == nil {
+		rt = &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+		}
+	}
+
+	return &Prober{
+		Client: &http.Client{
+			Transport: rt,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Backoff:        DefaultBackoff,
+		AttemptTimeout: defaultAttemptTimeout,
+		History:        defaultHistory,
+	}
+}
+
+// NewInsecure creates a prober which doesn't verify the certificates, e.g. to
+// probe a load balancer by its own hostname.
+func NewInsecure() *Prober {
+	return New(&http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+	})
+}
+
+// FollowRedirects makes the prober follow the redirects, and returns it.
+func (p *Prober) FollowRedirects() *Prober {
+	p.Client.CheckRedirect = nil
+	return p
+}
+
+// Get probes the url with GET requests until the response matches the
+// expectations.
+func (p *Prober) Get(ctx context.Context, url string, expectations ...Expectation) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Do(ctx, req, expectations...)
+}
+
+// Do sends the request until the response matches the expectations, or the
+// context is done, and then it returns an *Error. The body of the returned
+// response has already been read, and it can be read again.
+func (p *Prober) Do(ctx context.Context, req *http.Request, expectations ...Expectation) (*http.Response, error) {
+	if req.Body != nil && req.GetBody == nil {
+		return nil, fmt.Errorf("the body of the request to %s can't be sent again", req.URL)
+	}
+
+	start := time.Now()
+	failure := &Error{URL: req.URL.String(), Expectations: expectations}
+
+	var delay time.Duration
+	for {
+		rsp, attempt := p.attempt(ctx, req, expectations)
+		if attempt.Err == nil {
+			return rsp, nil
+		}
+
+		// an attempt cut short by the deadline of the probe would only hide
+		// the failures of the previous ones
+		cutShort := ctx.Err() != nil && attempt.Status == 0 && failure.NumAttempts > 0
+		if !cutShort {
+			failure.NumAttempts++
+			failure.Attempts = append(failure.Attempts, attempt)
+		}
+
+		if p.History > 0 && len(failure.Attempts) > p.History {
+			failure.Attempts = failure.Attempts[len(failure.Attempts)-p.History:]
+		}
+
+		delay = p.Backoff.next(delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			failure.Elapsed = time.Since(start)
+			return nil, failure
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *Prober) attempt(ctx context.Context, req *http.Request, expectations []Expectation) (*http.Response, Attempt) {
+	attempt := Attempt{Start: time.Now()}
+	fail := func(class ErrorClass, err error) (*http.Response, Attempt) {
+		attempt.Latency = time.Since(attempt.Start)
+		attempt.Class = class
+		attempt.Err = err
+		return nil, attempt
+	}
+
+	if p.AttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.AttemptTimeout)
+		defer cancel()
+	}
+
+	req = req.WithContext(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return fail(ClassOther, err)
+		}
+
+		req.Body = body
+	}
+
+	rsp, err := p.Client.Do(req)
+	if err != nil {
+		return fail(Classify(err), err)
+	}
+
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(rsp.Body, maxBodySize))
+	attempt.Status = rsp.StatusCode
+	if err != nil {
+		return fail(Classify(err), fmt.Errorf("failed to read the body: %v", err))
+	}
+
+	for _, expectation := range expectations {
+		if err := expectation.Check(rsp, body); err != nil {
+			return fail(ClassExpectation, err)
+		}
+	}
+
+	attempt.Latency = time.Since(attempt.Start)
+	rsp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return rsp, attempt
+}
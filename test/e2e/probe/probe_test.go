@@ -0,0 +1,272 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testProber(rt http.RoundTripper) *Prober {
+	p := New(rt)
+	p.Backoff = Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Factor: 2}
+	p.AttemptTimeout = time.Second
+	return p
+}
+
+func TestProbeEventuallySucceeds(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("X-Foo", "f00")
+		fmt.Fprint(w, "hello from the backend")
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rsp, err := testProber(nil).Get(ctx, server.URL,
+		StatusCode(http.StatusOK),
+		Header("X-Foo", "f00"),
+		BodyContains("backend"),
+		BodyMatches(regexp.MustCompile("^hello")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "hello from the backend" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+func TestProbeFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/somewhere-else", http.StatusPermanentRedirect)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	p := testProber(nil)
+	p.History = 3
+	_, err := p.Get(ctx, server.URL, StatusCode(http.StatusOK))
+
+	var failure *Error
+	if !errors.As(err, &failure) {
+		t.Fatalf("expected a probe error, got %v", err)
+	}
+
+	if failure.NumAttempts <= 3 || len(failure.Attempts) != 3 {
+		t.Fatalf("expected the last 3 of more than 3 attempts, got %d of %d", len(failure.Attempts), failure.NumAttempts)
+	}
+
+	for _, attempt := range failure.Attempts {
+		if attempt.Status != http.StatusPermanentRedirect || attempt.Class != ClassExpectation {
+			t.Errorf("expected the redirect not to be followed, got %s", attempt)
+		}
+	}
+
+	msg := err.Error()
+	for _, expected := range []string{server.URL, "(expected status 200)", "last 3 attempts", fmt.Sprintf("#%d at", failure.NumAttempts), "status 308", "expectation: expected status 200, got 308"} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("expected %q in the failure output:\n%s", expected, msg)
+		}
+	}
+}
+
+func TestProbeFollowRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.RedirectHandler("/target", http.StatusFound))
+	mux.HandleFunc("/target", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "target")
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := testProber(nil).FollowRedirects().Get(ctx, server.URL, StatusCode(http.StatusOK), BodyEquals("target")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProbeAttemptTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	p := testProber(nil)
+	p.AttemptTimeout = 20 * time.Millisecond
+	_, err := p.Get(ctx, server.URL)
+
+	var failure *Error
+	if !errors.As(err, &failure) {
+		t.Fatalf("expected a probe error, got %v", err)
+	}
+
+	if failure.NumAttempts < 2 || failure.LastClass() != ClassTimeout {
+		t.Errorf("expected several timed out attempts, got:\n%s", failure)
+	}
+}
+
+func TestProbeErrorClasses(t *testing.T) {
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	tlsServer.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	closedURL := closed.URL
+	closed.Close()
+
+	// resolve every name with a failing resolver instead of relying on the
+	// DNS of the test environment
+	unresolvable := &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(address)
+			return nil, &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}}
+		},
+	}
+
+	for _, test := range []struct {
+		title string
+		rt    http.RoundTripper
+		url   string
+		class ErrorClass
+	}{{
+		title: "untrusted certificate",
+		url:   tlsServer.URL,
+		class: ClassTLS,
+	}, {
+		title: "refused connection",
+		url:   closedURL,
+		class: ClassDial,
+	}, {
+		title: "unknown host",
+		rt:    unresolvable,
+		url:   "http://probe.example.org",
+		class: ClassDNS,
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			_, err := testProber(test.rt).Get(ctx, test.url)
+
+			var failure *Error
+			if !errors.As(err, &failure) {
+				t.Fatalf("expected a probe error, got %v", err)
+			}
+
+			if failure.LastClass() != test.class {
+				t.Errorf("expected class %q, got:\n%s", test.class, failure)
+			}
+
+			if !strings.Contains(failure.Error(), "no response") {
+				t.Errorf("expected attempts without a response, got:\n%s", failure)
+			}
+		})
+	}
+
+	t.Run("trusted certificate", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := testProber(tlsServer.Client().Transport).Get(ctx, tlsServer.URL, StatusCode(http.StatusOK)); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestClassify(t *testing.T) {
+	for _, test := range []struct {
+		err   error
+		class ErrorClass
+	}{
+		{nil, ClassNone},
+		{&url.Error{Op: "Get", URL: "https://example.org", Err: context.DeadlineExceeded}, ClassTimeout},
+		{&url.Error{Op: "Get", URL: "https://example.org", Err: errors.New("remote error: tls: handshake failure")}, ClassTLS},
+		{&url.Error{Op: "Get", URL: "https://example.org", Err: errors.New("net/http: TLS handshake timeout")}, ClassTLS},
+		{errors.New("unexpected EOF"), ClassOther},
+	} {
+		if class := Classify(test.err); class != test.class {
+			t.Errorf("expected %v to be classified as %q, got %q", test.err, test.class, class)
+		}
+	}
+}
+
+func TestRequestBodyIsSentAgain(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if atomic.AddInt32(&requests, 1) < 2 || string(body) != "payload" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := testProber(nil).Do(ctx, req, StatusCode(http.StatusOK)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 5 * time.Second, Factor: 2}
+
+	var delays []time.Duration
+	var delay time.Duration
+	for i := 0; i < 5; i++ {
+		delay = b.next(delay)
+		delays = append(delays, delay)
+	}
+
+	expected := fmt.Sprint([]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second})
+	if fmt.Sprint(delays) != expected {
+		t.Errorf("expected delays %s, got %v", expected, delays)
+	}
+}
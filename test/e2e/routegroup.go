@@ -0,0 +1,283 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/routegroup"
+	"k8s.io/kubernetes/test/e2e/framework"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// routeGroupScenario is a version of the route group of the shared backends,
+// and the requests expected to be routed according to it.
+type routeGroupScenario struct {
+	name string
+
+	// hosts are the prefixes of additional hostnames of the route group in
+	// the hosted zone
+	hosts []string
+
+	// backends are added to the service backends of the deployed backends,
+	// which are named after their services
+	backends []routegroup.Backend
+
+	// defaultBackends are skipperBackend when empty
+	defaultBackends []routegroup.BackendReference
+
+	// routes are a catch-all route of the default backends when empty
+	routes []routegroup.Route
+
+	requests []ingressRequest
+}
+
+// skipperRouteGroupScenarios check the features of skipper configured with
+// route groups.
+var skipperRouteGroupScenarios = []routeGroupScenario{{
+	name: "default backend",
+	requests: []ingressRequest{
+		{status: http.StatusOK, body: skipperBackend.content},
+	},
+}, {
+	name:  "additional host",
+	hosts: []string{"rg-foo"},
+	requests: []ingressRequest{
+		{host: "rg-foo", status: http.StatusOK, body: skipperBackend.content},
+		{status: http.StatusOK, body: skipperBackend.content},
+	},
+}, {
+	name: "multiple backends",
+	routes: []routegroup.Route{
+		{PathSubtree: "/foo"},
+		{PathSubtree: "/bar", Backends: []routegroup.BackendReference{routegroup.Ref(skipperBackend2.service, 0)}},
+	},
+	requests: []ingressRequest{
+		{path: "/bar", status: http.StatusOK, body: skipperBackend2.content},
+		{path: "/foo", status: http.StatusOK, body: skipperBackend.content},
+		{path: "/", status: http.StatusNotFound},
+	},
+}, {
+	name: "weighted backends without traffic",
+	defaultBackends: []routegroup.BackendReference{
+		routegroup.Ref(skipperBackend.service, 0),
+		routegroup.Ref(skipperBackend2.service, 100),
+	},
+	requests: []ingressRequest{
+		{status: http.StatusOK, body: skipperBackend2.content},
+	},
+}, {
+	name: "weighted backends sharing the traffic",
+	defaultBackends: []routegroup.BackendReference{
+		routegroup.Ref(skipperBackend.service, 50),
+		routegroup.Ref(skipperBackend2.service, 50),
+	},
+	requests: []ingressRequest{
+		{status: http.StatusOK, bodies: []string{skipperBackend.content, skipperBackend2.content}},
+	},
+}, {
+	name: "network backend",
+	backends: []routegroup.Backend{
+		routegroup.NetworkBackend("network", fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", skipperBackend2.service, namespacePlaceholder, ingressScenarioPort)),
+	},
+	defaultBackends: []routegroup.BackendReference{routegroup.Ref("network", 0)},
+	requests: []ingressRequest{
+		{status: http.StatusOK, body: skipperBackend2.content},
+	},
+}, {
+	name: "predicates and filters of the routes",
+	routes: []routegroup.Route{{
+		PathSubtree: "/",
+		Filters:     []string{`setResponseHeader("X-Foo", "f00")`},
+	}, {
+		PathSubtree: "/",
+		Predicates:  []string{`Header("X-Backend", "bar")`},
+		Filters:     []string{`setResponseHeader("X-Bar", "b4r")`},
+		Backends:    []routegroup.BackendReference{routegroup.Ref(skipperBackend2.service, 0)},
+	}},
+	requests: []ingressRequest{
+		{headers: map[string]string{"X-Backend": "bar"}, status: http.StatusOK, responseHeaders: map[string]string{"X-Bar": "b4r"}, body: skipperBackend2.content},
+		{status: http.StatusOK, responseHeaders: map[string]string{"X-Foo": "f00"}, body: skipperBackend.content},
+	},
+}}
+
+// routeGroupEquivalents are route groups routing like the ingresses of the
+// skipper ingress scenarios with the same names, and sending their requests.
+var routeGroupEquivalents = []routeGroupScenario{{
+	name: "default route",
+}, {
+	name:   "predicate matching the request",
+	routes: []routegroup.Route{{PathSubtree: "/", Methods: []string{http.MethodGet}}},
+}, {
+	name:   "predicate not matching the request",
+	routes: []routegroup.Route{{PathSubtree: "/", Methods: []string{http.MethodPut}}},
+}, {
+	name:   "filter",
+	routes: []routegroup.Route{{PathSubtree: "/", Filters: []string{`setResponseHeader("X-Foo", "f00")`}}},
+}, {
+	name:   "path",
+	routes: []routegroup.Route{{PathSubtree: "/foo"}},
+}, {
+	name: "paths of different backends",
+	routes: []routegroup.Route{
+		{PathSubtree: "/foo"},
+		{PathSubtree: "/bar", Backends: []routegroup.BackendReference{routegroup.Ref(skipperBackend2.service, 0)}},
+	},
+}, {
+	name:     "custom route",
+	backends: []routegroup.Backend{routegroup.ShuntBackend("shunt")},
+	routes: []routegroup.Route{{
+		PathSubtree: "/",
+	}, {
+		PathRegexp: "/redirect",
+		Filters:    []string{`modPath("/redirect", "/")`, `redirectTo(307, "https://$host/")`},
+		Backends:   []routegroup.BackendReference{routegroup.Ref("shunt", 0)},
+	}},
+}}
+
+var _ = framework.KubeDescribe("Skipper route groups", func() {
+	f := framework.NewDefaultFramework("skipper-routegroup")
+
+	It("Should create a load balancer and route according to the route group [RouteGroup] [Zalando]", func() {
+		deploySkipperBackends(f, skipperBackend, skipperBackend2)
+		runner := newRouteGroupScenarioRunner(f, skipperBackend, skipperBackend2)
+		defer runner.close()
+
+		for _, scenario := range skipperRouteGroupScenarios {
+			runner.run(scenario)
+		}
+	})
+
+	It("Should route like the equivalent ingress [RouteGroup] [Ingress] [Zalando]", func() {
+		deploySkipperBackends(f, skipperBackend, skipperBackend2)
+		ingressRunner := newIngressScenarioRunner(f, nil)
+		defer ingressRunner.close()
+
+		routeGroupRunner := newRouteGroupScenarioRunner(f, skipperBackend, skipperBackend2)
+		defer routeGroupRunner.close()
+
+		for _, equivalent := range routeGroupEquivalents {
+			scenario := lookupIngressScenario(equivalent.name)
+			ingressRunner.run(scenario)
+
+			equivalent.requests = scenario.requests
+			routeGroupRunner.run(equivalent)
+		}
+	})
+})
+
+// routeGroupScenarioRunner runs the scenarios against one route group, with a
+// load balancer and a hostname shared by all of them.
+type routeGroupScenarioRunner struct {
+	*scenarioClient
+
+	client   *routegroup.Client
+	name     string
+	labels   map[string]string
+	backends []ingressBackend
+}
+
+// newRouteGroupScenarioRunner creates a route group for the first backend,
+// once the backends are deployed. It waits for kube-ingress-aws-controller
+// to provision the load balancer of the route group, and for the hostname to
+// be ready.
+func newRouteGroupScenarioRunner(f *framework.Framework, backends ...ingressBackend) *routeGroupScenarioRunner {
+	ns := f.Namespace.Name
+	waitTime := 10 * time.Minute
+
+	r := &routeGroupScenarioRunner{
+		scenarioClient: newScenarioClient(ns, "skipper-routegroup-test"),
+		client:         routegroup.NewClient(f.DynamicClient),
+		labels:         map[string]string{"app": backends[0].service},
+		backends:       backends,
+	}
+
+	By("Creating route group " + backends[0].service + " in namespace " + ns + " with hostname " + r.hostName)
+	rg := createRouteGroup(backends[0].service, r.hostName, ns, r.labels, nil, ingressScenarioPort)
+	created, err := r.client.Create(rg)
+	Expect(err).NotTo(HaveOccurred())
+	r.name = created.Name
+
+	By("Waiting for the load balancer of route group " + r.name + " in its status")
+	ctx, cancel := context.WithTimeout(context.Background(), waitTime)
+	defer cancel()
+
+	addr, err := r.client.WaitForLoadBalancer(ctx, ns, r.name, 10*time.Second)
+	Expect(err).NotTo(HaveOccurred())
+
+	By("Waiting for skipper route to default redirect from http to https, to see that our ingress-controller and skipper works")
+	err = waitForResponse(addr, "http", waitTime, isRedirect, true)
+	Expect(err).NotTo(HaveOccurred())
+
+	By("Waiting for the load balancer to create endpoint " + addr + " and skipper route, to see that our ingress-controller and skipper works")
+	err = waitForResponse(addr, "https", waitTime, isNotFound, true)
+	Expect(err).NotTo(HaveOccurred())
+
+	By("Waiting for the DNS record of " + r.hostName + " to point to " + addr)
+	err = waitForDNSRecord(r.hostName, addr, waitTime)
+	Expect(err).NotTo(HaveOccurred())
+
+	By("Waiting for DNS to see that external-dns and skipper route to service and pod works")
+	err = waitForResponse(r.hostName, "https", waitTime, isSuccess, false)
+	Expect(err).NotTo(HaveOccurred())
+
+	r.start()
+	return r
+}
+
+// routeGroup returns the route group of the scenario.
+func (r *routeGroupScenarioRunner) routeGroup(s routeGroupScenario) *routegroup.RouteGroup {
+	routes := make([]routegroup.Route, 0, len(s.routes))
+	for _, route := range s.routes {
+		route.Filters = r.expandAll(route.Filters)
+		route.Predicates = r.expandAll(route.Predicates)
+		routes = append(routes, route)
+	}
+
+	rg := updateRouteGroup(r.name, r.namespace, r.hostName, r.labels, nil, routes...)
+	for _, backend := range r.backends {
+		rg = addBackendRouteGroup(rg, routegroup.ServiceBackend(backend.service, backend.service, ingressScenarioPort))
+	}
+
+	for _, backend := range s.backends {
+		backend.Address = r.expand(backend.Address)
+		rg = addBackendRouteGroup(rg, backend)
+	}
+
+	defaultBackends := s.defaultBackends
+	if len(defaultBackends) == 0 {
+		defaultBackends = []routegroup.BackendReference{routegroup.Ref(skipperBackend.service, 0)}
+	}
+
+	rg = setDefaultBackendsRouteGroup(rg, defaultBackends...)
+	return addHostRouteGroup(rg, r.hosts(s.hosts)...)
+}
+
+func (r *routeGroupScenarioRunner) expandAll(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	expanded := make([]string, 0, len(s))
+	for _, v := range s {
+		expanded = append(expanded, r.expand(v))
+	}
+
+	return expanded
+}
+
+// run updates the route group to the scenario, and sends its requests until
+// they get the expected responses.
+func (r *routeGroupScenarioRunner) run(s routeGroupScenario) {
+	By(fmt.Sprintf("Updating route group %s/%s for the scenario %q", r.namespace, r.name, s.name))
+	_, err := r.client.Update(r.routeGroup(s))
+	Expect(err).NotTo(HaveOccurred())
+
+	r.waitForHosts(s.hosts)
+	for _, request := range s.requests {
+		r.expect(s.name, request)
+	}
+}
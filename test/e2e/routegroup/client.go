@@ -0,0 +1,136 @@
+package routegroup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// Client reads and writes the route groups with the dynamic client.
+type Client struct {
+	client dynamic.Interface
+}
+
+// NewClient creates a client of the route groups, e.g. with the DynamicClient
+// of the e2e framework.
+func NewClient(client dynamic.Interface) *Client {
+	return &Client{client: client}
+}
+
+func (c *Client) resource(namespace string) dynamic.ResourceInterface {
+	return c.client.Resource(Resource).Namespace(namespace)
+}
+
+// ToUnstructured converts a route group to the object sent with the dynamic
+// client, filling in its apiVersion and kind.
+func ToUnstructured(rg *RouteGroup) (*unstructured.Unstructured, error) {
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(rg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert route group %s/%s: %v", rg.Namespace, rg.Name, err)
+	}
+
+	u := &unstructured.Unstructured{Object: object}
+	u.SetAPIVersion(APIVersion)
+	u.SetKind(Kind)
+	return u, nil
+}
+
+// FromUnstructured converts an object returned by the dynamic client to a
+// route group.
+func FromUnstructured(u *unstructured.Unstructured) (*RouteGroup, error) {
+	var rg RouteGroup
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &rg); err != nil {
+		return nil, fmt.Errorf("failed to convert route group %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+	}
+
+	return &rg, nil
+}
+
+func (c *Client) Create(rg *RouteGroup) (*RouteGroup, error) {
+	u, err := ToUnstructured(rg)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := c.resource(rg.Namespace).Create(u, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return FromUnstructured(created)
+}
+
+func (c *Client) Get(namespace, name string) (*RouteGroup, error) {
+	u, err := c.resource(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return FromUnstructured(u)
+}
+
+// Update replaces the route group. Unlike the built-in resources, custom
+// resources can't be updated unconditionally, so the current resource
+// version is used when the route group doesn't have one, e.g. when it was
+// built from scratch.
+func (c *Client) Update(rg *RouteGroup) (*RouteGroup, error) {
+	if rg.ResourceVersion == "" {
+		current, err := c.Get(rg.Namespace, rg.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		versioned := *rg
+		versioned.ResourceVersion = current.ResourceVersion
+		rg = &versioned
+	}
+
+	u, err := ToUnstructured(rg)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := c.resource(rg.Namespace).Update(u, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return FromUnstructured(updated)
+}
+
+func (c *Client) Delete(namespace, name string) error {
+	return c.resource(namespace).Delete(name, &metav1.DeleteOptions{})
+}
+
+// WaitForLoadBalancer polls the route group until its status has the
+// hostname of a load balancer, and returns it.
+func (c *Client) WaitForLoadBalancer(ctx context.Context, namespace, name string, interval time.Duration) (string, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		rg, err := c.Get(namespace, name)
+		if err == nil {
+			for _, lb := range rg.Status.LoadBalancer.RouteGroup {
+				if lb.Hostname != "" {
+					return lb.Hostname, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return "", fmt.Errorf("no load balancer for route group %s/%s: %v (last error: %v)", namespace, name, ctx.Err(), err)
+			}
+
+			return "", fmt.Errorf("no load balancer for route group %s/%s: %v", namespace, name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
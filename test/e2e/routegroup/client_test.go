@@ -0,0 +1,161 @@
+package routegroup
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func testRouteGroup() *RouteGroup {
+	return &RouteGroup{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-routes", Namespace: "default"},
+		Spec: Spec{
+			Hosts: []string{"foo.example.org"},
+			Backends: []Backend{
+				ServiceBackend("foo", "foo-service", 8080),
+				NetworkBackend("bar", "http://bar.default.svc.cluster.local:8080"),
+				ShuntBackend("shunt"),
+			},
+			DefaultBackends: []BackendReference{Ref("foo", 80), Ref("bar", 20)},
+			Routes: []Route{{
+				PathSubtree: "/",
+			}, {
+				Path:       "/redirect",
+				Methods:    []string{"GET"},
+				Predicates: []string{`Header("X-Foo", "f00")`},
+				Filters:    []string{`redirectTo(307, "https://foo.example.org/")`},
+				Backends:   []BackendReference{Ref("shunt", 0)},
+			}},
+		},
+	}
+}
+
+func TestUnstructuredRoundTrip(t *testing.T) {
+	rg := testRouteGroup()
+	u, err := ToUnstructured(rg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.GetAPIVersion() != APIVersion || u.GetKind() != Kind {
+		t.Errorf("unexpected type %s %s", u.GetAPIVersion(), u.GetKind())
+	}
+
+	backends, _, err := unstructured.NestedSlice(u.Object, "spec", "backends")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{"name": "foo", "type": "service", "serviceName": "foo-service", "servicePort": int64(8080)}
+	if !reflect.DeepEqual(backends[0], expected) {
+		t.Errorf("unexpected service backend %v, expected %v", backends[0], expected)
+	}
+
+	// the weight is optional
+	shunt, _, err := unstructured.NestedSlice(u.Object, "spec", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs := shunt[1].(map[string]interface{})["backends"].([]interface{})
+	if _, ok := refs[0].(map[string]interface{})["weight"]; ok {
+		t.Errorf("unexpected weight in %v", refs[0])
+	}
+
+	converted, err := FromUnstructured(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rg.APIVersion = APIVersion
+	rg.Kind = Kind
+	if !reflect.DeepEqual(converted, rg) {
+		t.Errorf("unexpected route group %+v, expected %+v", converted, rg)
+	}
+}
+
+func TestClient(t *testing.T) {
+	c := NewClient(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+
+	created, err := c.Create(testRouteGroup())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.Spec.Routes[1].Path != "/redirect" {
+		t.Errorf("unexpected routes %+v", created.Spec.Routes)
+	}
+
+	// a route group built from scratch replaces the current one
+	rg := testRouteGroup()
+	rg.Spec.Hosts = append(rg.Spec.Hosts, "bar.example.org")
+	if _, err := c.Update(rg); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := c.Get("default", "my-routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(current.Spec.Hosts, rg.Spec.Hosts) {
+		t.Errorf("unexpected hosts %v, expected %v", current.Spec.Hosts, rg.Spec.Hosts)
+	}
+
+	if err := c.Delete("default", "my-routes"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get("default", "my-routes"); err == nil {
+		t.Error("route group not deleted")
+	}
+
+	if _, err := c.Update(testRouteGroup()); err == nil {
+		t.Error("deleted route group updated")
+	}
+}
+
+func TestWaitForLoadBalancer(t *testing.T) {
+	c := NewClient(fake.NewSimpleDynamicClient(runtime.NewScheme()))
+	if _, err := c.Create(testRouteGroup()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.WaitForLoadBalancer(ctx, "default", "my-routes", 10*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no load balancer for route group default/my-routes") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		rg, err := c.Get("default", "my-routes")
+		if err != nil {
+			return
+		}
+
+		rg.Status.LoadBalancer.RouteGroup = []LoadBalancer{{Hostname: "my-alb.eu-central-1.elb.amazonaws.com"}}
+		c.Update(rg)
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hostname, err := c.WaitForLoadBalancer(ctx, "default", "my-routes", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hostname != "my-alb.eu-central-1.elb.amazonaws.com" {
+		t.Errorf("unexpected load balancer %s", hostname)
+	}
+}
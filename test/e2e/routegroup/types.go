@@ -0,0 +1,124 @@
+// Package routegroup has the types of the RouteGroup custom resource of
+// skipper (cluster/manifests/skipper/crd.yaml), and a client for them on top
+// of the dynamic client, as there's no generated clientset in the suite.
+package routegroup
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	APIVersion = "zalando.org/v1"
+	Kind       = "RouteGroup"
+)
+
+// Resource is the resource of the route groups.
+var Resource = schema.GroupVersionResource{
+	Group:    "zalando.org",
+	Version:  "v1",
+	Resource: "routegroups",
+}
+
+// RouteGroup routes the requests to its hosts with its routes to its
+// backends.
+type RouteGroup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   Spec   `json:"spec"`
+	Status Status `json:"status,omitempty"`
+}
+
+type Spec struct {
+	Hosts    []string  `json:"hosts,omitempty"`
+	Backends []Backend `json:"backends"`
+
+	// DefaultBackends are the backends of the routes without backends.
+	DefaultBackends []BackendReference `json:"defaultBackends,omitempty"`
+
+	Routes []Route `json:"routes"`
+}
+
+type BackendType string
+
+const (
+	ServiceBackendType  BackendType = "service"
+	ShuntBackendType    BackendType = "shunt"
+	LoopbackBackendType BackendType = "loopback"
+	DynamicBackendType  BackendType = "dynamic"
+	LBBackendType       BackendType = "lb"
+	NetworkBackendType  BackendType = "network"
+)
+
+// Backend is a backend of the routes, referenced by its name.
+type Backend struct {
+	Name string      `json:"name"`
+	Type BackendType `json:"type"`
+
+	// Address is the URL of a network backend.
+	Address string `json:"address,omitempty"`
+
+	ServiceName string `json:"serviceName,omitempty"`
+	ServicePort int    `json:"servicePort,omitempty"`
+
+	// Algorithm and Endpoints configure an lb backend.
+	Algorithm string   `json:"algorithm,omitempty"`
+	Endpoints []string `json:"endpoints,omitempty"`
+}
+
+// BackendReference is a backend of a route. The traffic is split between the
+// backends of a route by their weights.
+type BackendReference struct {
+	BackendName string `json:"backendName"`
+	Weight      int    `json:"weight,omitempty"`
+}
+
+// Route matches the requests by their path, method and predicates, and
+// applies its filters before forwarding them to its backends.
+type Route struct {
+	Path        string `json:"path,omitempty"`
+	PathSubtree string `json:"pathSubtree,omitempty"`
+	PathRegexp  string `json:"pathRegexp,omitempty"`
+
+	Backends   []BackendReference `json:"backends,omitempty"`
+	Filters    []string           `json:"filters,omitempty"`
+	Predicates []string           `json:"predicates,omitempty"`
+	Methods    []string           `json:"methods,omitempty"`
+}
+
+// Status is set by kube-ingress-aws-controller.
+type Status struct {
+	LoadBalancer LoadBalancerStatus `json:"loadBalancer,omitempty"`
+}
+
+type LoadBalancerStatus struct {
+	RouteGroup []LoadBalancer `json:"routeGroup,omitempty"`
+}
+
+// LoadBalancer is a load balancer serving the hosts of the route group.
+type LoadBalancer struct {
+	IP       string `json:"ip,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// ServiceBackend returns a backend forwarding to a port of a service.
+func ServiceBackend(name, serviceName string, servicePort int) Backend {
+	return Backend{Name: name, Type: ServiceBackendType, ServiceName: serviceName, ServicePort: servicePort}
+}
+
+// NetworkBackend returns a backend forwarding to a URL.
+func NetworkBackend(name, address string) Backend {
+	return Backend{Name: name, Type: NetworkBackendType, Address: address}
+}
+
+// ShuntBackend returns a backend for the routes responding on their own,
+// e.g. with a redirect.
+func ShuntBackend(name string) Backend {
+	return Backend{Name: name, Type: ShuntBackendType}
+}
+
+// Ref returns a reference to a backend with a weight, where 0 is no weight.
+func Ref(backendName string, weight int) BackendReference {
+	return BackendReference{BackendName: backendName, Weight: weight}
+}
@@ -0,0 +1,263 @@
+// Package tlscheck inspects the TLS served by an endpoint, e.g. the load
+// balancer of an ingress: whether its certificate chain validates and covers
+// the hostname, and which protocol versions and cipher suites it accepts,
+// compared to the ELB security policy it's configured with.
+package tlscheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultHandshakeTimeout = 10 * time.Second
+
+// Inspection is the TLS served by an endpoint.
+type Inspection struct {
+	Address    string
+	ServerName string
+
+	// Chain is the certificate chain served by the endpoint.
+	Chain []*x509.Certificate
+
+	// ChainErr is the error of the verification of the chain, without
+	// checking the hostname.
+	ChainErr error
+
+	// HostnameErr is the error of checking whether the certificate covers
+	// the server name.
+	HostnameErr error
+
+	// Versions are the accepted protocol versions.
+	Versions []uint16
+
+	// Ciphers are the cipher suites accepted with the highest TLS 1.0-1.2
+	// version.
+	Ciphers []uint16
+}
+
+// Inspector performs the handshakes of the inspections.
+type Inspector struct {
+	// Roots are the trusted certificate authorities, the system ones when
+	// nil.
+	Roots *x509.CertPool
+
+	// HandshakeTimeout bounds every handshake.
+	HandshakeTimeout time.Duration
+}
+
+// NewInspector creates an inspector trusting the system certificate
+// authorities.
+func NewInspector() *Inspector {
+	return &Inspector{HandshakeTimeout: defaultHandshakeTimeout}
+}
+
+// Inspect connects to the address (host:port) with the server name to verify
+// the chain, and then once per protocol version and cipher suite to find the
+// accepted ones. It only fails when the endpoint can't be reached or doesn't
+// accept any handshake.
+func (i *Inspector) Inspect(ctx context.Context, address, serverName string) (*Inspection, error) {
+	inspection := &Inspection{Address: address, ServerName: serverName}
+
+	for _, version := range Versions {
+		state, err := i.handshake(ctx, address, &tls.Config{
+			ServerName: serverName,
+			MinVersion: version,
+			MaxVersion: version,
+		})
+		if isNetworkError(err) {
+			return nil, err
+		}
+
+		if err != nil {
+			continue
+		}
+
+		inspection.Versions = append(inspection.Versions, version)
+		if inspection.Chain == nil {
+			inspection.Chain = state.PeerCertificates
+		}
+	}
+
+	if len(inspection.Versions) == 0 {
+		return nil, fmt.Errorf("%s didn't accept any TLS handshake", address)
+	}
+
+	inspection.ChainErr, inspection.HostnameErr = i.verify(inspection.Chain, serverName)
+
+	// the cipher suites of TLS 1.3 can't be chosen
+	cipherVersion := uint16(0)
+	for _, version := range inspection.Versions {
+		if version <= tls.VersionTLS12 {
+			cipherVersion = version
+		}
+	}
+
+	if cipherVersion == 0 {
+		return inspection, nil
+	}
+
+	for _, c := range ciphers {
+		_, err := i.handshake(ctx, address, &tls.Config{
+			ServerName:   serverName,
+			MinVersion:   cipherVersion,
+			MaxVersion:   cipherVersion,
+			CipherSuites: []uint16{c.ID},
+		})
+		if isNetworkError(err) {
+			return nil, err
+		}
+
+		if err == nil {
+			inspection.Ciphers = append(inspection.Ciphers, c.ID)
+		}
+	}
+
+	return inspection, nil
+}
+
+// handshake performs a handshake without verifying the certificates, which
+// are verified separately.
+func (i *Inspector) handshake(ctx context.Context, address string, config *tls.Config) (*tls.ConnectionState, error) {
+	if i.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.HandshakeTimeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	config.InsecureSkipVerify = true
+	client := tls.Client(conn, config)
+	if err := client.Handshake(); err != nil {
+		return nil, &handshakeError{err: err}
+	}
+
+	state := client.ConnectionState()
+	return &state, nil
+}
+
+// handshakeError is a handshake refused by the endpoint, unlike a failed
+// connection.
+type handshakeError struct {
+	err error
+}
+
+func (e *handshakeError) Error() string {
+	return e.err.Error()
+}
+
+func isNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	_, refused := err.(*handshakeError)
+	return !refused
+}
+
+func (i *Inspector) verify(chain []*x509.Certificate, serverName string) (chainErr, hostnameErr error) {
+	if len(chain) == 0 {
+		return fmt.Errorf("no certificates served"), fmt.Errorf("no certificates served")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, chainErr = chain[0].Verify(x509.VerifyOptions{Roots: i.Roots, Intermediates: intermediates})
+	return chainErr, chain[0].VerifyHostname(serverName)
+}
+
+// Violations returns how the endpoint doesn't match the security policy, and
+// whether its certificate isn't valid for the server name.
+func (in *Inspection) Violations(policy SecurityPolicy) []string {
+	var violations []string
+	if in.ChainErr != nil {
+		violations = append(violations, fmt.Sprintf("invalid certificate chain: %v", in.ChainErr))
+	}
+
+	if in.HostnameErr != nil {
+		violations = append(violations, fmt.Sprintf("certificate not valid for %s: %v", in.ServerName, in.HostnameErr))
+	}
+
+	for _, version := range Versions {
+		accepted := containsID(in.Versions, version)
+		if accepted && !policy.acceptsVersion(version) {
+			violations = append(violations, fmt.Sprintf("%s accepted", VersionName(version)))
+		} else if !accepted && policy.acceptsVersion(version) {
+			violations = append(violations, fmt.Sprintf("%s refused", VersionName(version)))
+		}
+	}
+
+	// not every cipher of the policy can be negotiated, e.g. the ECDSA
+	// ones with an RSA certificate
+	for _, id := range in.Ciphers {
+		if !policy.acceptsCipher(id) {
+			violations = append(violations, fmt.Sprintf("cipher %s accepted", CipherName(id)))
+		}
+	}
+
+	if len(in.Ciphers) == 0 && containsID(in.Versions, tls.VersionTLS12) {
+		violations = append(violations, "no cipher accepted")
+	}
+
+	return violations
+}
+
+// Check returns an error listing the violations of the policy, or nil.
+func (in *Inspection) Check(policy SecurityPolicy) error {
+	violations := in.Violations(policy)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%s (%s) doesn't match %s:\n  %s\n%s", in.Address, in.ServerName, policy.Name, strings.Join(violations, "\n  "), in)
+}
+
+func (in *Inspection) String() string {
+	versions := make([]string, 0, len(in.Versions))
+	for _, version := range in.Versions {
+		versions = append(versions, VersionName(version))
+	}
+
+	ciphers := make([]string, 0, len(in.Ciphers))
+	for _, id := range in.Ciphers {
+		ciphers = append(ciphers, CipherName(id))
+	}
+	sort.Strings(ciphers)
+
+	var subject string
+	if len(in.Chain) > 0 {
+		subject = fmt.Sprintf("%s (SAN %s, issued by %s, expires %s)", in.Chain[0].Subject.CommonName, strings.Join(in.Chain[0].DNSNames, ", "), in.Chain[0].Issuer.CommonName, in.Chain[0].NotAfter.Format(time.RFC3339))
+	}
+
+	return fmt.Sprintf("certificate: %s\nversions: %s\nciphers: %s", subject, strings.Join(versions, ", "), strings.Join(ciphers, ", "))
+}
+
+func containsID(ids []uint16, id uint16) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
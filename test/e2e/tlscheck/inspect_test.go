@@ -0,0 +1,370 @@
+package tlscheck
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// newTestCert creates a certificate signed by the parent, or a self-signed
+// certificate authority without a parent.
+func newTestCert(t *testing.T, name string, parent *testCert, key crypto.Signer, dnsNames ...string) *testCert {
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	if len(dnsNames) == 0 {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+	}
+
+	signer := &testCert{cert: template, key: key}
+	if parent != nil {
+		signer = parent
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, key.Public(), signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCert{cert: cert, key: key}
+}
+
+func rsaKey(t *testing.T) crypto.Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func ecdsaKey(t *testing.T) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func (c *testCert) tlsCertificate(chain ...*testCert) tls.Certificate {
+	certificate := tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+	for _, cert := range chain {
+		certificate.Certificate = append(certificate.Certificate, cert.cert.Raw)
+	}
+
+	return certificate
+}
+
+// startTLSServer accepts TLS connections until the test ends, and returns
+// the address.
+func startTLSServer(t *testing.T, config *tls.Config) (string, func()) {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func testInspector(ca *testCert) *Inspector {
+	inspector := NewInspector()
+	inspector.HandshakeTimeout = 5 * time.Second
+	if ca != nil {
+		inspector.Roots = x509.NewCertPool()
+		inspector.Roots.AddCert(ca.cert)
+	}
+
+	return inspector
+}
+
+func testPolicy(t *testing.T, name string) SecurityPolicy {
+	policy, err := LookupSecurityPolicy(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return policy
+}
+
+func TestInspect(t *testing.T) {
+	ca := newTestCert(t, "test root", nil, rsaKey(t))
+	intermediate := newTestCert(t, "test intermediate", ca, rsaKey(t))
+	rsaLeaf := newTestCert(t, "ingress.example.org", intermediate, rsaKey(t), "ingress.example.org", "*.apps.example.org")
+	ecdsaLeaf := newTestCert(t, "ingress.example.org", ca, ecdsaKey(t), "ingress.example.org")
+
+	tls12 := testPolicy(t, "ELBSecurityPolicy-TLS-1-2-2017-01")
+	compatible := testPolicy(t, "ELBSecurityPolicy-2016-08")
+
+	for _, test := range []struct {
+		title      string
+		server     *tls.Config
+		roots      *testCert
+		serverName string
+		policy     SecurityPolicy
+		versions   []uint16
+		ciphers    []string
+		violations []string
+	}{{
+		title: "TLS 1.2 policy",
+		server: &tls.Config{
+			Certificates: []tls.Certificate{rsaLeaf.tlsCertificate(intermediate)},
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: tls12.Ciphers,
+		},
+		roots:      ca,
+		serverName: "ingress.example.org",
+		policy:     tls12,
+		versions:   []uint16{tls.VersionTLS12},
+		ciphers:    []string{"AES128-GCM-SHA256", "AES128-SHA256", "AES256-GCM-SHA384", "ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-SHA256", "ECDHE-RSA-AES256-GCM-SHA384"},
+	}, {
+		title: "ECDSA certificate",
+		server: &tls.Config{
+			Certificates: []tls.Certificate{ecdsaLeaf.tlsCertificate()},
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: tls12.Ciphers,
+		},
+		roots:      ca,
+		serverName: "ingress.example.org",
+		policy:     tls12,
+		versions:   []uint16{tls.VersionTLS12},
+		ciphers:    []string{"ECDHE-ECDSA-AES128-GCM-SHA256", "ECDHE-ECDSA-AES128-SHA256", "ECDHE-ECDSA-AES256-GCM-SHA384"},
+	}, {
+		title: "TLS 1.0 and 1.1 accepted",
+		server: &tls.Config{
+			Certificates: []tls.Certificate{rsaLeaf.tlsCertificate(intermediate)},
+			MinVersion:   tls.VersionTLS10,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: cipherIDs("ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-SHA"),
+		},
+		roots:      ca,
+		serverName: "foo.apps.example.org",
+		policy:     tls12,
+		versions:   []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12},
+		ciphers:    []string{"ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-SHA"},
+		violations: []string{"TLS 1.0 accepted", "TLS 1.1 accepted", "cipher ECDHE-RSA-AES128-SHA accepted"},
+	}, {
+		title: "compatible policy",
+		server: &tls.Config{
+			Certificates: []tls.Certificate{rsaLeaf.tlsCertificate(intermediate)},
+			MinVersion:   tls.VersionTLS10,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: cipherIDs("ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-SHA"),
+		},
+		roots:      ca,
+		serverName: "ingress.example.org",
+		policy:     compatible,
+		versions:   []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12},
+		ciphers:    []string{"ECDHE-RSA-AES128-GCM-SHA256", "ECDHE-RSA-AES128-SHA"},
+	}, {
+		title: "TLS 1.3 and weak ciphers accepted",
+		server: &tls.Config{
+			Certificates: []tls.Certificate{rsaLeaf.tlsCertificate(intermediate)},
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS13,
+			CipherSuites: cipherIDs("ECDHE-RSA-AES128-GCM-SHA256", "DES-CBC3-SHA"),
+		},
+		roots:      ca,
+		serverName: "ingress.example.org",
+		policy:     tls12,
+		versions:   []uint16{tls.VersionTLS12, tls.VersionTLS13},
+		ciphers:    []string{"DES-CBC3-SHA", "ECDHE-RSA-AES128-GCM-SHA256"},
+		violations: []string{"TLS 1.3 accepted", "cipher DES-CBC3-SHA accepted"},
+	}, {
+		title: "wrong host",
+		server: &tls.Config{
+			Certificates: []tls.Certificate{rsaLeaf.tlsCertificate(intermediate)},
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: cipherIDs("ECDHE-RSA-AES128-GCM-SHA256"),
+		},
+		roots:      ca,
+		serverName: "other.example.org",
+		policy:     tls12,
+		versions:   []uint16{tls.VersionTLS12},
+		ciphers:    []string{"ECDHE-RSA-AES128-GCM-SHA256"},
+		violations: []string{"certificate not valid for other.example.org"},
+	}, {
+		title: "missing intermediate",
+		server: &tls.Config{
+			Certificates: []tls.Certificate{rsaLeaf.tlsCertificate()},
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: cipherIDs("ECDHE-RSA-AES128-GCM-SHA256"),
+		},
+		roots:      ca,
+		serverName: "ingress.example.org",
+		policy:     tls12,
+		versions:   []uint16{tls.VersionTLS12},
+		ciphers:    []string{"ECDHE-RSA-AES128-GCM-SHA256"},
+		violations: []string{"invalid certificate chain"},
+	}, {
+		title: "untrusted root",
+		server: &tls.Config{
+			Certificates: []tls.Certificate{rsaLeaf.tlsCertificate(intermediate)},
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: cipherIDs("ECDHE-RSA-AES128-GCM-SHA256"),
+		},
+		roots:      newTestCert(t, "other root", nil, rsaKey(t)),
+		serverName: "ingress.example.org",
+		policy:     tls12,
+		versions:   []uint16{tls.VersionTLS12},
+		ciphers:    []string{"ECDHE-RSA-AES128-GCM-SHA256"},
+		violations: []string{"invalid certificate chain"},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			address, stop := startTLSServer(t, test.server)
+			defer stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			inspection, err := testInspector(test.roots).Inspect(ctx, address, test.serverName)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(inspection.Versions, test.versions) {
+				t.Errorf("expected versions %v, got %v", test.versions, inspection.Versions)
+			}
+
+			var ciphers []string
+			for _, id := range inspection.Ciphers {
+				ciphers = append(ciphers, CipherName(id))
+			}
+
+			if strings.Join(sortedStrings(ciphers), " ") != strings.Join(test.ciphers, " ") {
+				t.Errorf("expected ciphers %v, got %v", test.ciphers, sortedStrings(ciphers))
+			}
+
+			violations := inspection.Violations(test.policy)
+			if len(violations) != len(test.violations) {
+				t.Fatalf("expected violations %q, got %q", test.violations, violations)
+			}
+
+			for i, violation := range violations {
+				if !strings.HasPrefix(violation, test.violations[i]) {
+					t.Errorf("expected violation %q, got %q", test.violations[i], violation)
+				}
+			}
+
+			err = inspection.Check(test.policy)
+			if (err == nil) != (len(test.violations) == 0) {
+				t.Errorf("unexpected result of the check: %v", err)
+			}
+		})
+	}
+}
+
+func sortedStrings(s []string) []string {
+	sorted := append([]string(nil), s...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func TestInspectUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := listener.Addr().String()
+	listener.Close()
+
+	if _, err := testInspector(nil).Inspect(context.Background(), address, "ingress.example.org"); err == nil {
+		t.Error("expected an error for a closed port")
+	}
+}
+
+func TestInspectNotTLS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+
+	_, err = testInspector(nil).Inspect(context.Background(), listener.Addr().String(), "ingress.example.org")
+	if err == nil || !strings.Contains(err.Error(), "didn't accept any TLS handshake") {
+		t.Errorf("expected no accepted handshakes, got %v", err)
+	}
+}
+
+func TestSecurityPolicies(t *testing.T) {
+	if _, err := LookupSecurityPolicy("ELBSecurityPolicy-Unknown"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+
+	for name, policy := range SecurityPolicies {
+		if policy.MinVersion > policy.MaxVersion || len(policy.Ciphers) == 0 {
+			t.Errorf("invalid policy %s", name)
+		}
+	}
+}
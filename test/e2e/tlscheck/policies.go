@@ -0,0 +1,183 @@
+package tlscheck
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// Cipher is a TLS 1.0-1.2 cipher suite, with the OpenSSL name used by the
+// AWS security policies.
+type Cipher struct {
+	ID   uint16
+	Name string
+}
+
+// ciphers are the cipher suites probed by the inspections, the ones of the
+// ELB security policies supported by crypto/tls and a few weak ones.
+var ciphers = []Cipher{
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, "ECDHE-ECDSA-AES128-GCM-SHA256"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, "ECDHE-RSA-AES128-GCM-SHA256"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256, "ECDHE-ECDSA-AES128-SHA256"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256, "ECDHE-RSA-AES128-SHA256"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, "ECDHE-ECDSA-AES128-SHA"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, "ECDHE-RSA-AES128-SHA"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, "ECDHE-ECDSA-AES256-GCM-SHA384"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, "ECDHE-RSA-AES256-GCM-SHA384"},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, "ECDHE-ECDSA-AES256-SHA"},
+	{tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, "ECDHE-RSA-AES256-SHA"},
+	{tls.TLS_RSA_WITH_AES_128_GCM_SHA256, "AES128-GCM-SHA256"},
+	{tls.TLS_RSA_WITH_AES_128_CBC_SHA256, "AES128-SHA256"},
+	{tls.TLS_RSA_WITH_AES_128_CBC_SHA, "AES128-SHA"},
+	{tls.TLS_RSA_WITH_AES_256_GCM_SHA384, "AES256-GCM-SHA384"},
+	{tls.TLS_RSA_WITH_AES_256_CBC_SHA, "AES256-SHA"},
+	{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305, "ECDHE-ECDSA-CHACHA20-POLY1305"},
+	{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, "ECDHE-RSA-CHACHA20-POLY1305"},
+	{tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA, "DES-CBC3-SHA"},
+	{tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA, "ECDHE-RSA-DES-CBC3-SHA"},
+	{tls.TLS_RSA_WITH_RC4_128_SHA, "RC4-SHA"},
+}
+
+// CipherName returns the OpenSSL name of a cipher suite.
+func CipherName(id uint16) string {
+	for _, c := range ciphers {
+		if c.ID == id {
+			return c.Name
+		}
+	}
+
+	return fmt.Sprintf("0x%04x", id)
+}
+
+func cipherIDs(names ...string) []uint16 {
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, c := range ciphers {
+			if c.Name == name {
+				ids = append(ids, c.ID)
+				found = true
+			}
+		}
+
+		if !found {
+			panic("unknown cipher " + name)
+		}
+	}
+
+	return ids
+}
+
+// Versions are the probed protocol versions, the oldest first.
+var Versions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+
+// VersionName returns the name of a protocol version.
+func VersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04x", version)
+	}
+}
+
+// SecurityPolicy is the protocol versions and the TLS 1.0-1.2 cipher suites
+// accepted by a load balancer.
+type SecurityPolicy struct {
+	Name       string
+	MinVersion uint16
+	MaxVersion uint16
+
+	// Ciphers are the cipher suites of the policy known to crypto/tls.
+	Ciphers []uint16
+}
+
+// the ciphers of ELBSecurityPolicy-TLS-1-2-2017-01
+var tls12Ciphers = []string{
+	"ECDHE-ECDSA-AES128-GCM-SHA256",
+	"ECDHE-RSA-AES128-GCM-SHA256",
+	"ECDHE-ECDSA-AES128-SHA256",
+	"ECDHE-RSA-AES128-SHA256",
+	"ECDHE-ECDSA-AES256-GCM-SHA384",
+	"ECDHE-RSA-AES256-GCM-SHA384",
+	"AES128-GCM-SHA256",
+	"AES128-SHA256",
+	"AES256-GCM-SHA384",
+}
+
+// the ciphers of ELBSecurityPolicy-2016-08
+var compatibleCiphers = append([]string{
+	"ECDHE-ECDSA-AES128-SHA",
+	"ECDHE-RSA-AES128-SHA",
+	"ECDHE-ECDSA-AES256-SHA",
+	"ECDHE-RSA-AES256-SHA",
+	"AES128-SHA",
+	"AES256-SHA",
+}, tls12Ciphers...)
+
+// SecurityPolicies are the predefined ELB security policies which can be
+// configured with kube_aws_ingress_controller_ssl_policy.
+var SecurityPolicies = map[string]SecurityPolicy{
+	"ELBSecurityPolicy-2016-08": {
+		MinVersion: tls.VersionTLS10,
+		MaxVersion: tls.VersionTLS12,
+		Ciphers:    cipherIDs(compatibleCiphers...),
+	},
+	"ELBSecurityPolicy-TLS-1-1-2017-01": {
+		MinVersion: tls.VersionTLS11,
+		MaxVersion: tls.VersionTLS12,
+		Ciphers:    cipherIDs(compatibleCiphers...),
+	},
+	"ELBSecurityPolicy-TLS-1-2-2017-01": {
+		MinVersion: tls.VersionTLS12,
+		MaxVersion: tls.VersionTLS12,
+		Ciphers:    cipherIDs(tls12Ciphers...),
+	},
+	"ELBSecurityPolicy-TLS-1-2-Ext-2018-06": {
+		MinVersion: tls.VersionTLS12,
+		MaxVersion: tls.VersionTLS12,
+		Ciphers:    cipherIDs(compatibleCiphers...),
+	},
+	"ELBSecurityPolicy-FS-1-2-Res-2019-08": {
+		MinVersion: tls.VersionTLS12,
+		MaxVersion: tls.VersionTLS12,
+		Ciphers: cipherIDs(
+			"ECDHE-ECDSA-AES128-GCM-SHA256",
+			"ECDHE-RSA-AES128-GCM-SHA256",
+			"ECDHE-ECDSA-AES128-SHA256",
+			"ECDHE-RSA-AES128-SHA256",
+			"ECDHE-ECDSA-AES256-GCM-SHA384",
+			"ECDHE-RSA-AES256-GCM-SHA384",
+		),
+	},
+}
+
+// LookupSecurityPolicy returns a predefined ELB security policy.
+func LookupSecurityPolicy(name string) (SecurityPolicy, error) {
+	policy, ok := SecurityPolicies[name]
+	if !ok {
+		return SecurityPolicy{}, fmt.Errorf("unknown security policy %s", name)
+	}
+
+	policy.Name = name
+	return policy, nil
+}
+
+func (p SecurityPolicy) acceptsVersion(version uint16) bool {
+	return version >= p.MinVersion && version <= p.MaxVersion
+}
+
+func (p SecurityPolicy) acceptsCipher(id uint16) bool {
+	for _, c := range p.Ciphers {
+		if c == id {
+			return true
+		}
+	}
+
+	return false
+}
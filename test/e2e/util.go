@@ -1,11 +1,8 @@
 package e2e
 
 import (
-	"bytes"
-	"crypto/tls"
+	"context"
 	"fmt"
-	"io"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
@@ -22,6 +19,8 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	zv1 "github.com/zalando-incubator/kube-aws-iam-controller/pkg/apis/zalando.org/v1"
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/probe"
+	"github.com/zalando-incubator/kubernetes-on-aws/tests/e2e/routegroup"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
@@ -141,6 +140,46 @@ func changePathIngress(ing *v1beta1.Ingress, path string) *v1beta1.Ingress {
 	)
 }
 
+func createRouteGroup(name, hostname, namespace string, labels, annotations map[string]string, port int) *routegroup.RouteGroup {
+	rg := updateRouteGroup(name+string(uuid.NewUUID()), namespace, hostname, labels, annotations)
+	rg = addBackendRouteGroup(rg, routegroup.ServiceBackend(name, name, port))
+	return setDefaultBackendsRouteGroup(rg, routegroup.Ref(name, 0))
+}
+
+func updateRouteGroup(name, namespace, hostname string, labels, annotations map[string]string, routes ...routegroup.Route) *routegroup.RouteGroup {
+	if len(routes) == 0 {
+		routes = []routegroup.Route{{PathSubtree: "/"}}
+	}
+
+	return &routegroup.RouteGroup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: routegroup.Spec{
+			Hosts:  []string{hostname},
+			Routes: routes,
+		},
+	}
+}
+
+func addHostRouteGroup(rg *routegroup.RouteGroup, hostnames ...string) *routegroup.RouteGroup {
+	rg.Spec.Hosts = append(rg.Spec.Hosts, hostnames...)
+	return rg
+}
+
+func addBackendRouteGroup(rg *routegroup.RouteGroup, backends ...routegroup.Backend) *routegroup.RouteGroup {
+	rg.Spec.Backends = append(rg.Spec.Backends, backends...)
+	return rg
+}
+
+func setDefaultBackendsRouteGroup(rg *routegroup.RouteGroup, backends ...routegroup.BackendReference) *routegroup.RouteGroup {
+	rg.Spec.DefaultBackends = backends
+	return rg
+}
+
 func createNginxDeployment(nameprefix, namespace string, label map[string]string, port, replicas int32) *appsv1.Deployment {
 	zero := int64(0)
 	return &appsv1.Deployment{
@@ -500,103 +539,75 @@ func createServiceTypeLoadbalancer(serviceName, hostName string, labels map[stri
 	}
 }
 
-func waitForSuccessfulResponse(hostname string, timeout time.Duration) error {
-	client := http.Client{
-		Transport: &http.Transport{},
-		Timeout:   10 * time.Second,
-	}
+var (
+	isRedirect = probe.StatusMatches("a redirect", func(code int) bool { return code >= 300 && code <= 399 })
+	isSuccess  = probe.StatusCode(http.StatusOK)
+	isNotFound = probe.StatusCode(http.StatusNotFound)
+)
 
-	url, err := url.Parse(hostname)
+// waitForSuccessfulResponse waits for the hostname to respond with 200 over
+// HTTP, following the redirects.
+func waitForSuccessfulResponse(hostname string, timeout time.Duration) error {
+	url, err := probeURL(hostname, "http")
 	if err != nil {
 		return err
 	}
 
-	url.Scheme = "http"
-
-	host := url.String()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err = probe.New(nil).FollowRedirects().Get(ctx, url, isSuccess)
+	return err
+}
 
-	req, err := http.NewRequest("GET", host, nil)
+// waitForResponse waits for the hostname to respond as expected with the
+// scheme. The redirects are not followed.
+func waitForResponse(hostname, scheme string, timeout time.Duration, expected probe.Expectation, insecure bool) error {
+	url, err := probeURL(hostname, scheme)
 	if err != nil {
 		return err
 	}
 
-	timeoutEnd := time.Now().UTC().Add(timeout)
-
-	for time.Now().UTC().Before(timeoutEnd) {
-		resp, err := client.Do(req)
-		if err != nil {
-			time.Sleep(10 * time.Second)
-			continue
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode == http.StatusOK {
-			return nil
-		}
+	p := probe.New(nil)
+	if insecure {
+		p = probe.NewInsecure()
 	}
 
-	return fmt.Errorf("%s was not reachable after %s", host, timeout)
-}
-
-func isRedirect(code int) bool {
-	return code >= 300 && code <= 399
-}
-
-func isSuccess(code int) bool {
-	return code == http.StatusOK
-}
-
-func isNotFound(code int) bool {
-	return code == http.StatusNotFound
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err = p.Get(ctx, url, expected)
+	return err
 }
 
-func waitForResponse(hostname, scheme string, timeout time.Duration, expectedCode func(int) bool, insecure bool) error {
-	localTimeout := 10 * time.Second
-	if timeout < localTimeout {
-		localTimeout = timeout
-	}
-	url, err := url.Parse(hostname)
+func probeURL(hostname, scheme string) (string, error) {
+	u, err := url.Parse(hostname)
 	if err != nil {
-		return err
-	}
-
-	url.Scheme = scheme
-
-	host := url.String()
-
-	req, err := http.NewRequest("GET", host, nil)
-	if err != nil {
-		return err
+		return "", err
 	}
 
-	timeoutEnd := time.Now().UTC().Add(timeout)
-
-	for time.Now().UTC().Before(timeoutEnd) {
-		t := &http.Transport{}
-		if insecure {
-			t = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
-		}
-		client := http.Client{
-			Transport: t,
-			Timeout:   localTimeout,
-			CheckRedirect: func(r *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		}
+	u.Scheme = scheme
+	return u.String(), nil
+}
 
-		resp, err := client.Do(req)
+// waitForServiceLoadBalancer waits for the hostname of the load balancer of
+// a service of type LoadBalancer.
+func waitForServiceLoadBalancer(cs kubernetes.Interface, namespace, name string, timeout time.Duration) (string, error) {
+	var hostname string
+	err := wait.PollImmediate(10*time.Second, timeout, func() (bool, error) {
+		service, err := cs.CoreV1().Services(namespace).Get(name, metav1.GetOptions{})
 		if err != nil {
-			time.Sleep(localTimeout)
-			continue
+			return false, err
 		}
-		defer resp.Body.Close()
 
-		if expectedCode(resp.StatusCode) {
-			return nil
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.Hostname != "" {
+				hostname = ingress.Hostname
+				return true, nil
+			}
 		}
-	}
 
-	return fmt.Errorf("%s was not reachable after %s", host, timeout)
+		return false, nil
+	})
+	return hostname, err
 }
 
 func waitForReplicas(deploymentName, namespace string, kubeClient kubernetes.Interface, timeout time.Duration, desiredReplicas int) {
@@ -757,50 +768,6 @@ func createHTTPRoundTripper() (http.RoundTripper, chan<- struct{}) {
 	return tr, ch
 }
 
-func getAndWaitResponse(rt http.RoundTripper, req *http.Request, timeout time.Duration, expectedStatusCode int) (resp *http.Response, err error) {
-	d := 1 * time.Second
-	if timeout < d {
-		d = timeout - 1
-	}
-	timeoutCH := make(chan struct{})
-	go func() {
-		time.Sleep(timeout)
-		timeoutCH <- struct{}{}
-	}()
-
-	for {
-		resp, err = rt.RoundTrip(req)
-		if err == nil && resp.StatusCode == expectedStatusCode {
-			return
-		}
-		if err != nil {
-			log.Printf("Failed to do rountrip: %v", err)
-		}
-
-		select {
-		case <-timeoutCH:
-			log.Printf("timeout to GET %s", req.URL)
-			return
-		case <-time.After(d):
-			log.Printf("retry to GET %s", req.URL)
-			continue
-		}
-	}
-}
-
-func getBody(resp *http.Response) (string, error) {
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		return "", fmt.Errorf("response code from backend: %d", resp.StatusCode)
-	}
-	b := make([]byte, 0, 1024)
-	buf := bytes.NewBuffer(b)
-	if _, err := io.Copy(buf, resp.Body); err != nil {
-		return "", fmt.Errorf("failed to copy body: %v", err)
-	}
-	return buf.String(), nil
-}
-
 func getPodLogs(c kubernetes.Interface, namespace, podName, containerName string, previous bool) (string, error) {
 	logs, err := c.CoreV1().RESTClient().Get().
 		Resource("pods").
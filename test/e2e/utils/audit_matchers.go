@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+// AuditExpectation is an expected audit event, either an AuditEvent, which
+// has to match exactly, or an AuditEventMatcher.
+type AuditExpectation interface {
+	// Mismatches returns the names of the fields of the event that don't
+	// match the expectation. The event is the expected one when there are
+	// none.
+	Mismatches(e *auditinternal.Event) []string
+
+	String() string
+}
+
+// AuditEvents returns the expectations of exact audit events.
+func AuditEvents(events ...AuditEvent) []AuditExpectation {
+	expectations := make([]AuditExpectation, 0, len(events))
+	for _, e := range events {
+		expectations = append(expectations, e)
+	}
+
+	return expectations
+}
+
+// Mismatches returns the fields of the event that differ from the expected
+// ones. The admission webhook annotations of the event are not compared.
+func (expected AuditEvent) Mismatches(e *auditinternal.Event) []string {
+	event, err := testEventFromInternal(e)
+	if err != nil {
+		return []string{fmt.Sprintf("event: %v", err)}
+	}
+
+	// reset Annotation maps as we don't want to compare those
+	event.AdmissionWebhookMutationAnnotations = nil
+	event.AdmissionWebhookPatchAnnotations = nil
+
+	var mismatches []string
+	expectedValue, eventValue := reflect.ValueOf(expected), reflect.ValueOf(event)
+	for i := 0; i < expectedValue.NumField(); i++ {
+		if !reflect.DeepEqual(expectedValue.Field(i).Interface(), eventValue.Field(i).Interface()) {
+			mismatches = append(mismatches, expectedValue.Type().Field(i).Name)
+		}
+	}
+
+	return mismatches
+}
+
+func (expected AuditEvent) String() string {
+	// the conversion drops the String method, which would recurse
+	type auditEvent AuditEvent
+	return fmt.Sprintf("%+v", auditEvent(expected))
+}
+
+// StringMatcher matches a string field of an audit event. The zero value
+// matches any value.
+type StringMatcher struct {
+	description string
+	match       func(string) bool
+}
+
+// Equals matches the value.
+func Equals(value string) StringMatcher {
+	return StringMatcher{
+		description: fmt.Sprintf("%q", value),
+		match:       func(s string) bool { return s == value },
+	}
+}
+
+// HasPrefix matches the values starting with the prefix.
+func HasPrefix(prefix string) StringMatcher {
+	return StringMatcher{
+		description: fmt.Sprintf("prefix %q", prefix),
+		match:       func(s string) bool { return strings.HasPrefix(s, prefix) },
+	}
+}
+
+// Contains matches the values containing the substring.
+func Contains(substring string) StringMatcher {
+	return StringMatcher{
+		description: fmt.Sprintf("containing %q", substring),
+		match:       func(s string) bool { return strings.Contains(s, substring) },
+	}
+}
+
+// MatchesRegexp matches the values matching the regular expression anywhere.
+// It panics if the expression is invalid.
+func MatchesRegexp(expr string) StringMatcher {
+	re := regexp.MustCompile(expr)
+	return StringMatcher{
+		description: "/" + expr + "/",
+		match:       re.MatchString,
+	}
+}
+
+// IsSet tells whether the matcher restricts the value.
+func (m StringMatcher) IsSet() bool {
+	return m.match != nil
+}
+
+// Match tells whether the value matches.
+func (m StringMatcher) Match(value string) bool {
+	return m.match == nil || m.match(value)
+}
+
+// MatchAny tells whether any of the values matches. A matcher that is not
+// set matches even no values.
+func (m StringMatcher) MatchAny(values []string) bool {
+	if m.match == nil {
+		return true
+	}
+
+	for _, v := range values {
+		if m.match(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m StringMatcher) String() string {
+	if m.match == nil {
+		return "any"
+	}
+
+	return m.description
+}
+
+// AuditEventMatcher is an expectation on an audit event where only the set
+// fields are compared.
+type AuditEventMatcher struct {
+	Level      StringMatcher
+	Stage      StringMatcher
+	RequestURI StringMatcher
+	Verb       StringMatcher
+	UserAgent  StringMatcher
+
+	// Code is the response code, any code when zero.
+	Code int32
+
+	User StringMatcher
+
+	// Group matches when any group of the user matches.
+	Group StringMatcher
+
+	// SourceIP matches when any source IP matches.
+	SourceIP StringMatcher
+
+	// Impersonated requires an impersonated user when true, and no
+	// impersonation when false.
+	Impersonated *bool
+
+	ImpersonatedUser StringMatcher
+
+	// ImpersonatedGroup matches when any impersonated group matches.
+	ImpersonatedGroup StringMatcher
+
+	APIGroup    StringMatcher
+	Resource    StringMatcher
+	Subresource StringMatcher
+	Namespace   StringMatcher
+	Name        StringMatcher
+
+	// RequestObject and ResponseObject require the object to be logged when
+	// true, and not logged when false.
+	RequestObject  *bool
+	ResponseObject *bool
+
+	// Annotations match the annotations of the event by key. A missing
+	// annotation has the empty value.
+	Annotations map[string]StringMatcher
+}
+
+// Mismatches returns the names of the set fields that don't match the event.
+func (m AuditEventMatcher) Mismatches(e *auditinternal.Event) []string {
+	var mismatches []string
+	check := func(name string, matches bool) {
+		if !matches {
+			mismatches = append(mismatches, name)
+		}
+	}
+
+	check("Level", m.Level.Match(string(e.Level)))
+	check("Stage", m.Stage.Match(string(e.Stage)))
+	check("RequestURI", m.RequestURI.Match(e.RequestURI))
+	check("Verb", m.Verb.Match(e.Verb))
+	check("UserAgent", m.UserAgent.Match(e.UserAgent))
+
+	var code int32
+	if e.ResponseStatus != nil {
+		code = e.ResponseStatus.Code
+	}
+	check("Code", m.Code == 0 || m.Code == code)
+
+	check("User", m.User.Match(e.User.Username))
+	check("Group", m.Group.MatchAny(e.User.Groups))
+	check("SourceIP", m.SourceIP.MatchAny(e.SourceIPs))
+
+	var impersonatedUser string
+	var impersonatedGroups []string
+	if e.ImpersonatedUser != nil {
+		impersonatedUser = e.ImpersonatedUser.Username
+		impersonatedGroups = e.ImpersonatedUser.Groups
+	}
+	check("Impersonated", m.Impersonated == nil || *m.Impersonated == (e.ImpersonatedUser != nil))
+	check("ImpersonatedUser", m.ImpersonatedUser.Match(impersonatedUser))
+	check("ImpersonatedGroup", m.ImpersonatedGroup.MatchAny(impersonatedGroups))
+
+	ref := e.ObjectRef
+	if ref == nil {
+		ref = &auditinternal.ObjectReference{}
+	}
+	check("APIGroup", m.APIGroup.Match(ref.APIGroup))
+	check("Resource", m.Resource.Match(ref.Resource))
+	check("Subresource", m.Subresource.Match(ref.Subresource))
+	check("Namespace", m.Namespace.Match(ref.Namespace))
+	check("Name", m.Name.Match(ref.Name))
+
+	check("RequestObject", m.RequestObject == nil || *m.RequestObject == (e.RequestObject != nil))
+	check("ResponseObject", m.ResponseObject == nil || *m.ResponseObject == (e.ResponseObject != nil))
+
+	for _, key := range annotationKeys(m.Annotations) {
+		check("Annotations["+key+"]", m.Annotations[key].Match(e.Annotations[key]))
+	}
+
+	return mismatches
+}
+
+func annotationKeys(annotations map[string]StringMatcher) []string {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// String returns the set fields of the matcher.
+func (m AuditEventMatcher) String() string {
+	var fields []string
+	add := func(name string, matcher StringMatcher) {
+		if matcher.IsSet() {
+			fields = append(fields, name+"="+matcher.String())
+		}
+	}
+
+	addBool := func(name string, value *bool) {
+		if value != nil {
+			fields = append(fields, fmt.Sprintf("%s=%t", name, *value))
+		}
+	}
+
+	add("Level", m.Level)
+	add("Stage", m.Stage)
+	add("RequestURI", m.RequestURI)
+	add("Verb", m.Verb)
+	add("UserAgent", m.UserAgent)
+	if m.Code != 0 {
+		fields = append(fields, fmt.Sprintf("Code=%d", m.Code))
+	}
+	add("User", m.User)
+	add("Group", m.Group)
+	add("SourceIP", m.SourceIP)
+	addBool("Impersonated", m.Impersonated)
+	add("ImpersonatedUser", m.ImpersonatedUser)
+	add("ImpersonatedGroup", m.ImpersonatedGroup)
+	add("APIGroup", m.APIGroup)
+	add("Resource", m.Resource)
+	add("Subresource", m.Subresource)
+	add("Namespace", m.Namespace)
+	add("Name", m.Name)
+	addBool("RequestObject", m.RequestObject)
+	addBool("ResponseObject", m.ResponseObject)
+	for _, key := range annotationKeys(m.Annotations) {
+		add("Annotations["+key+"]", m.Annotations[key])
+	}
+
+	return "{" + strings.Join(fields, " ") + "}"
+}
+
+// describeEvent returns the fields of an audit event compared by the
+// expectations.
+func describeEvent(e *auditinternal.Event) string {
+	if e == nil {
+		return "none"
+	}
+
+	var code int32
+	if e.ResponseStatus != nil {
+		code = e.ResponseStatus.Code
+	}
+
+	s := fmt.Sprintf(
+		"%s %s %s %s code=%d user=%s groups=%v sourceIPs=%v userAgent=%q",
+		e.Level,
+		e.Stage,
+		e.Verb,
+		e.RequestURI,
+		code,
+		e.User.Username,
+		e.User.Groups,
+		e.SourceIPs,
+		e.UserAgent,
+	)
+
+	if e.ImpersonatedUser != nil {
+		s += fmt.Sprintf(" impersonated=%s%v", e.ImpersonatedUser.Username, e.ImpersonatedUser.Groups)
+	}
+
+	if len(e.Annotations) > 0 {
+		s += fmt.Sprintf(" annotations=%v", e.Annotations)
+	}
+
+	return s
+}
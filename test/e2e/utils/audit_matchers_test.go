@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	authnv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+func testAuditEvent() auditinternal.Event {
+	return auditinternal.Event{
+		Level:      auditinternal.LevelRequest,
+		Stage:      auditinternal.StageResponseComplete,
+		RequestURI: "/api/v1/namespaces/teapot/pods/foo",
+		Verb:       "patch",
+		User: authnv1.UserInfo{
+			Username: "test-user",
+			Groups:   []string{"system:authenticated", "PowerUser"},
+		},
+		ImpersonatedUser: &authnv1.UserInfo{
+			Username: "other-user",
+			Groups:   []string{"ReadOnly"},
+		},
+		SourceIPs: []string{"10.0.0.1", "172.31.0.1"},
+		UserAgent: "kubectl/v1.17.4 (linux/amd64) kubernetes/8d8aa39",
+		ObjectRef: &auditinternal.ObjectReference{
+			Resource:  "pods",
+			Namespace: "teapot",
+			Name:      "foo",
+		},
+		ResponseStatus: &metav1.Status{Code: 200},
+		RequestObject:  &runtime.Unknown{},
+		Annotations: map[string]string{
+			"authorization.k8s.io/decision": "allow",
+		},
+	}
+}
+
+// testAuditLine returns the event as a line of the audit log.
+func testAuditLine(t *testing.T, e auditinternal.Event) string {
+	var v1Event auditv1.Event
+	if err := auditv1.Convert_audit_Event_To_v1_Event(&e, &v1Event, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	v1Event.APIVersion = auditv1.SchemeGroupVersion.String()
+	v1Event.Kind = "Event"
+	line, err := json.Marshal(v1Event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(line)
+}
+
+func TestAuditEventMatcher(t *testing.T) {
+	yes, no := true, false
+	for _, test := range []struct {
+		title      string
+		matcher    AuditEventMatcher
+		mismatches []string
+	}{{
+		title: "empty",
+	}, {
+		title: "all fields",
+		matcher: AuditEventMatcher{
+			Level:             Equals("Request"),
+			Stage:             Equals("ResponseComplete"),
+			RequestURI:        HasPrefix("/api/v1/namespaces/teapot/"),
+			Verb:              Equals("patch"),
+			UserAgent:         Contains("kubectl"),
+			Code:              200,
+			User:              Equals("test-user"),
+			Group:             Equals("PowerUser"),
+			SourceIP:          HasPrefix("172.31."),
+			Impersonated:      &yes,
+			ImpersonatedUser:  Equals("other-user"),
+			ImpersonatedGroup: Equals("ReadOnly"),
+			Resource:          Equals("pods"),
+			Namespace:         Equals("teapot"),
+			Name:              MatchesRegexp("^f"),
+			RequestObject:     &yes,
+			ResponseObject:    &no,
+			Annotations: map[string]StringMatcher{
+				"authorization.k8s.io/decision": Equals("allow"),
+			},
+		},
+	}, {
+		title: "mismatches",
+		matcher: AuditEventMatcher{
+			Verb:         Equals("patch"),
+			Group:        Equals("ReadOnly"),
+			Impersonated: &no,
+			Subresource:  Equals("status"),
+			Annotations: map[string]StringMatcher{
+				"authorization.k8s.io/decision": Equals("allow"),
+				"authorization.k8s.io/reason":   Contains("RBAC"),
+			},
+		},
+		mismatches: []string{"Group", "Impersonated", "Subresource", "Annotations[authorization.k8s.io/reason]"},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			e := testAuditEvent()
+			if mismatches := test.matcher.Mismatches(&e); !reflect.DeepEqual(mismatches, test.mismatches) {
+				t.Errorf("expected mismatches %v, got %v", test.mismatches, mismatches)
+			}
+		})
+	}
+}
+
+func TestAuditEventMismatches(t *testing.T) {
+	e := testAuditEvent()
+	expected := AuditEvent{
+		Level:              auditinternal.LevelRequest,
+		Stage:              auditinternal.StageResponseComplete,
+		RequestURI:         "/api/v1/namespaces/teapot/pods/foo",
+		Verb:               "update",
+		Code:               200,
+		User:               "test-user",
+		ImpersonatedUser:   "other-user",
+		ImpersonatedGroups: "ReadOnly",
+		Resource:           "pods",
+		Namespace:          "teapot",
+		RequestObject:      true,
+		AuthorizeDecision:  "allow",
+	}
+
+	if mismatches := expected.Mismatches(&e); !reflect.DeepEqual(mismatches, []string{"Verb"}) {
+		t.Errorf("expected a mismatching verb, got %v", mismatches)
+	}
+
+	expected.Verb = "patch"
+	if mismatches := expected.Mismatches(&e); len(mismatches) != 0 {
+		t.Errorf("expected no mismatches, got %v", mismatches)
+	}
+}
+
+func TestCheckAuditLinesNearestCandidate(t *testing.T) {
+	var lines []string
+	for _, verb := range []string{"get", "patch"} {
+		e := testAuditEvent()
+		e.Verb = verb
+		lines = append(lines, testAuditLine(t, e))
+	}
+
+	report, err := CheckAuditLines(
+		strings.NewReader(strings.Join(lines, "\n")),
+		[]AuditExpectation{
+			AuditEventMatcher{Verb: Equals("get"), User: Equals("test-user")},
+			AuditEventMatcher{Verb: Equals("patch"), Namespace: Equals("default"), Code: 200},
+		},
+		auditv1.SchemeGroupVersion,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.NumEventsChecked != 2 || len(report.MissingEvents) != 1 {
+		t.Fatalf("expected one missing event out of 2 checked, got: %s", report)
+	}
+
+	nearest := report.NearestCandidates[0]
+	if nearest.Event == nil || nearest.Event.Verb != "patch" || !reflect.DeepEqual(nearest.Mismatches, []string{"Namespace"}) {
+		t.Errorf("unexpected nearest candidate: %s", report)
+	}
+
+	if !strings.Contains(report.String(), "mismatching Namespace") {
+		t.Errorf("nearest candidate not reported: %s", report)
+	}
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+// SensitiveResources select the events of the resources whose bodies must
+// never be logged: secrets and platform credentials sets. The AWS IAM
+// credentials are covered by the secrets matcher, because
+// kube-aws-iam-controller stores the credentials of an AWSIAMRole in a
+// secret.
+var SensitiveResources = []AuditExpectation{
+	AuditEventMatcher{APIGroup: Equals(""), Resource: Equals("secrets")},
+	AuditEventMatcher{APIGroup: Equals("zalando.org"), Resource: Equals("platformcredentialssets")},
+}
+
+// redactedEvent is the expectation on the events of the sensitive resources.
+var redactedEvent = func() AuditExpectation {
+	no := false
+	return AuditEventMatcher{
+		Level:          Equals(string(auditinternal.LevelMetadata)),
+		RequestObject:  &no,
+		ResponseObject: &no,
+	}
+}()
+
+// RedactionViolation is an event of a sensitive resource logged with more
+// than its metadata.
+type RedactionViolation struct {
+	Event      *auditinternal.Event
+	Mismatches []string
+}
+
+// AuditRedactionReport provides the outcome of checking the events of the
+// sensitive resources.
+type AuditRedactionReport struct {
+	NumEventsChecked   int
+	NumSensitiveEvents int
+	Violations         []RedactionViolation
+}
+
+// AuditIDs returns the IDs of the offending events.
+func (r *AuditRedactionReport) AuditIDs() []string {
+	ids := make([]string, 0, len(r.Violations))
+	for _, v := range r.Violations {
+		ids = append(ids, string(v.Event.AuditID))
+	}
+
+	return ids
+}
+
+// String returns a human readable string representation of the report
+func (r *AuditRedactionReport) String() string {
+	lines := []string{fmt.Sprintf(
+		"%d events checked, %d of sensitive resources, %d logged with more than their metadata",
+		r.NumEventsChecked,
+		r.NumSensitiveEvents,
+		len(r.Violations),
+	)}
+
+	for _, v := range r.Violations {
+		lines = append(lines, fmt.Sprintf("- %s: mismatching %s: %s", v.Event.AuditID, strings.Join(v.Mismatches, ", "), describeEvent(v.Event)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Err returns an error listing the IDs of the offending events, if any.
+func (r *AuditRedactionReport) Err() error {
+	if len(r.Violations) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("events of sensitive resources logged with more than their metadata: %s", strings.Join(r.AuditIDs(), ", "))
+}
+
+// AuditRedactionChecker checks that the events of the sensitive resources
+// are logged at the Metadata level, without request and response objects.
+type AuditRedactionChecker struct {
+	sensitive []AuditExpectation
+	report    AuditRedactionReport
+}
+
+// NewAuditRedactionChecker creates a checker for the events selected by the
+// expectations, usually SensitiveResources.
+func NewAuditRedactionChecker(sensitive []AuditExpectation) *AuditRedactionChecker {
+	return &AuditRedactionChecker{sensitive: sensitive}
+}
+
+// Check checks an event.
+func (c *AuditRedactionChecker) Check(e *auditinternal.Event) {
+	c.report.NumEventsChecked++
+	for _, s := range c.sensitive {
+		if len(s.Mismatches(e)) > 0 {
+			continue
+		}
+
+		c.report.NumSensitiveEvents++
+		if mismatches := redactedEvent.Mismatches(e); len(mismatches) > 0 {
+			c.report.Violations = append(c.report.Violations, RedactionViolation{Event: e, Mismatches: mismatches})
+		}
+
+		return
+	}
+}
+
+// Report returns the outcome of the checks so far.
+func (c *AuditRedactionChecker) Report() *AuditRedactionReport {
+	report := c.report
+	return &report
+}
+
+// CheckAuditRedaction checks the audit log for events of the sensitive
+// resources logged with more than their metadata.
+func CheckAuditRedaction(stream io.Reader, sensitive []AuditExpectation, version schema.GroupVersion) (*AuditRedactionReport, error) {
+	checker := NewAuditRedactionChecker(sensitive)
+	_, err := scanAuditLines(stream, version, checker.Check)
+	return checker.Report(), err
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+func TestCheckAuditRedaction(t *testing.T) {
+	var lines []string
+	add := func(id string, modify func(e *auditinternal.Event)) {
+		e := testAuditEvent()
+		e.AuditID = types.UID(id)
+		e.Level = auditinternal.LevelMetadata
+		e.RequestObject = nil
+		e.ObjectRef = &auditinternal.ObjectReference{Resource: "secrets", Namespace: "teapot", Name: "foo"}
+		modify(&e)
+		lines = append(lines, testAuditLine(t, e))
+	}
+
+	add("redacted-secret", func(e *auditinternal.Event) {})
+	add("secret-request", func(e *auditinternal.Event) {
+		e.Level = auditinternal.LevelRequest
+		e.RequestObject = &runtime.Unknown{Raw: []byte(`{"data":{"password":"c2VjcmV0"}}`)}
+	})
+	add("pcs-response", func(e *auditinternal.Event) {
+		e.Level = auditinternal.LevelRequestResponse
+		e.ObjectRef = &auditinternal.ObjectReference{APIGroup: "zalando.org", Resource: "platformcredentialssets", Namespace: "teapot", Name: "foo"}
+		e.ResponseObject = &runtime.Unknown{Raw: []byte(`{}`)}
+	})
+	add("pod", func(e *auditinternal.Event) {
+		e.Level = auditinternal.LevelRequest
+		e.ObjectRef.Resource = "pods"
+		e.RequestObject = &runtime.Unknown{Raw: []byte(`{}`)}
+	})
+	add("secrets-of-another-group", func(e *auditinternal.Event) {
+		e.Level = auditinternal.LevelRequest
+		e.ObjectRef.APIGroup = "example.org"
+	})
+
+	report, err := CheckAuditRedaction(strings.NewReader(strings.Join(lines, "\n")), SensitiveResources, auditv1.SchemeGroupVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.NumEventsChecked != 5 || report.NumSensitiveEvents != 3 {
+		t.Errorf("expected 3 sensitive events out of 5, got: %s", report)
+	}
+
+	if ids := report.AuditIDs(); !reflect.DeepEqual(ids, []string{"secret-request", "pcs-response"}) {
+		t.Errorf("unexpected offending events %v", ids)
+	}
+
+	if !reflect.DeepEqual(report.Violations[0].Mismatches, []string{"Level", "RequestObject"}) {
+		t.Errorf("unexpected mismatches %v", report.Violations[0].Mismatches)
+	}
+
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "secret-request, pcs-response") {
+		t.Errorf("expected an error listing the offending events, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+// AuditSequence expects audit events to occur in order.
+type AuditSequence struct {
+	Events []AuditExpectation
+
+	// Scope makes the sequence strictly contiguous: once the first event of
+	// the sequence occurred, every event matching the scope must be the next
+	// expected event, e.g. with a scope matching the events of an object, no
+	// other request may touch the object in between. Otherwise the sequence
+	// starts over.
+	Scope AuditExpectation
+}
+
+func (s AuditSequence) String() string {
+	events := make([]string, 0, len(s.Events))
+	for _, e := range s.Events {
+		events = append(events, e.String())
+	}
+
+	sequence := strings.Join(events, " -> ")
+	if s.Scope != nil {
+		sequence += fmt.Sprintf(" (contiguous for %s)", s.Scope)
+	}
+
+	return sequence
+}
+
+// AuditAssertions are expectations on the order of audit events and on the
+// audit events that must not occur.
+type AuditAssertions struct {
+	Sequences []AuditSequence
+
+	// Forbidden are the events that must not occur.
+	Forbidden []AuditExpectation
+
+	// Since and Until restrict the checked events to the ones received in
+	// the window, when set. They are compared with the timestamps of the API
+	// server, so they must come from its clock rather than the local one.
+	Since time.Time
+	Until time.Time
+}
+
+// SequenceResult is the outcome of checking an AuditSequence.
+type SequenceResult struct {
+	Sequence AuditSequence
+
+	// Matched is the number of events of the sequence found in order, in
+	// the most advanced attempt.
+	Matched int
+
+	// Interruption is the last event that broke a contiguous sequence, if
+	// any.
+	Interruption *auditinternal.Event
+}
+
+// Complete tells whether all the events of the sequence were found.
+func (r SequenceResult) Complete() bool {
+	return r.Matched == len(r.Sequence.Events)
+}
+
+// ForbiddenEvent is an event that must not occur.
+type ForbiddenEvent struct {
+	Expectation AuditExpectation
+	Event       *auditinternal.Event
+}
+
+// AuditAssertionsReport provides the outcome of checking AuditAssertions.
+type AuditAssertionsReport struct {
+	NumEventsChecked int
+	Sequences        []SequenceResult
+	ForbiddenEvents  []ForbiddenEvent
+}
+
+// Incomplete returns the sequences that were not found entirely.
+func (r *AuditAssertionsReport) Incomplete() []SequenceResult {
+	var incomplete []SequenceResult
+	for _, s := range r.Sequences {
+		if !s.Complete() {
+			incomplete = append(incomplete, s)
+		}
+	}
+
+	return incomplete
+}
+
+// String returns a human readable string representation of the report
+func (r *AuditAssertionsReport) String() string {
+	var problems []string
+	for _, s := range r.Incomplete() {
+		problem := fmt.Sprintf("- incomplete sequence, %d of %d events found in order: %s", s.Matched, len(s.Sequence.Events), s.Sequence)
+		if s.Interruption != nil {
+			problem += "\n  interrupted by: " + describeEvent(s.Interruption)
+		}
+
+		problems = append(problems, problem)
+	}
+
+	for _, f := range r.ForbiddenEvents {
+		problems = append(problems, fmt.Sprintf("- forbidden event %s occurred: %s", f.Expectation, describeEvent(f.Event)))
+	}
+
+	return fmt.Sprintf("%d events checked\n\n%s", r.NumEventsChecked, strings.Join(problems, "\n"))
+}
+
+// sequenceTracker follows the progress of an AuditSequence.
+type sequenceTracker struct {
+	result SequenceResult
+	next   int
+}
+
+func (t *sequenceTracker) mark(e *auditinternal.Event) {
+	events := t.result.Sequence.Events
+	if t.next == len(events) {
+		return
+	}
+
+	if len(events[t.next].Mismatches(e)) == 0 {
+		t.next++
+	} else if scope := t.result.Sequence.Scope; t.next > 0 && scope != nil && len(scope.Mismatches(e)) == 0 {
+		// the sequence is interrupted, but the event can start a new one
+		t.result.Interruption = e
+		t.next = 0
+		if len(events[0].Mismatches(e)) == 0 {
+			t.next = 1
+		}
+	}
+
+	if t.next > t.result.Matched {
+		t.result.Matched = t.next
+	}
+}
+
+// auditAssertionsChecker checks the AuditAssertions event by event.
+type auditAssertionsChecker struct {
+	assertions AuditAssertions
+	sequences  []*sequenceTracker
+	report     *AuditAssertionsReport
+}
+
+func newAuditAssertionsChecker(assertions AuditAssertions) *auditAssertionsChecker {
+	c := &auditAssertionsChecker{assertions: assertions, report: &AuditAssertionsReport{}}
+	for _, s := range assertions.Sequences {
+		c.sequences = append(c.sequences, &sequenceTracker{result: SequenceResult{Sequence: s}})
+	}
+
+	return c
+}
+
+func (c *auditAssertionsChecker) check(e *auditinternal.Event) {
+	received := e.RequestReceivedTimestamp.Time
+	if !c.assertions.Since.IsZero() && received.Before(c.assertions.Since) ||
+		!c.assertions.Until.IsZero() && received.After(c.assertions.Until) {
+		return
+	}
+
+	c.report.NumEventsChecked++
+	for _, s := range c.sequences {
+		s.mark(e)
+	}
+
+	for _, f := range c.assertions.Forbidden {
+		if len(f.Mismatches(e)) == 0 {
+			c.report.ForbiddenEvents = append(c.report.ForbiddenEvents, ForbiddenEvent{Expectation: f, Event: e})
+		}
+	}
+}
+
+func (c *auditAssertionsChecker) finish() *AuditAssertionsReport {
+	// the results are collected again, the checker can continue
+	c.report.Sequences = nil
+	for _, s := range c.sequences {
+		c.report.Sequences = append(c.report.Sequences, s.result)
+	}
+
+	return c.report
+}
+
+// CheckAuditSequences checks the audit log for the sequences and the
+// forbidden events of the assertions.
+func CheckAuditSequences(stream io.Reader, assertions AuditAssertions, version schema.GroupVersion) (*AuditAssertionsReport, error) {
+	checker := newAuditAssertionsChecker(assertions)
+	if _, err := scanAuditLines(stream, version, checker.check); err != nil {
+		return checker.finish(), err
+	}
+
+	return checker.finish(), nil
+}
+
+// CheckAuditListSequences checks an audit event list for the sequences and
+// the forbidden events of the assertions.
+func CheckAuditListSequences(el auditinternal.EventList, assertions AuditAssertions) *AuditAssertionsReport {
+	checker := newAuditAssertionsChecker(assertions)
+	for i := range el.Items {
+		checker.check(&el.Items[i])
+	}
+
+	return checker.finish()
+}
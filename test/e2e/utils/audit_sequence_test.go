@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+func testEventList(start time.Time, events ...string) auditinternal.EventList {
+	var el auditinternal.EventList
+	for i, verbAndUser := range events {
+		parts := strings.SplitN(verbAndUser, " ", 2)
+		e := testAuditEvent()
+		e.Verb = parts[0]
+		e.User.Username = parts[1]
+		e.RequestReceivedTimestamp = metav1.NewMicroTime(start.Add(time.Duration(i) * time.Second))
+		el.Items = append(el.Items, e)
+	}
+
+	return el
+}
+
+func TestCheckAuditListSequences(t *testing.T) {
+	start := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	byTestUser := func(verb string) AuditExpectation {
+		return AuditEventMatcher{Verb: Equals(verb), User: Equals("test-user")}
+	}
+
+	sequence := []AuditExpectation{byTestUser("create"), byTestUser("update"), byTestUser("delete")}
+	podEvents := AuditEventMatcher{Resource: Equals("pods"), Name: Equals("foo")}
+
+	for _, test := range []struct {
+		title      string
+		events     []string
+		assertions AuditAssertions
+		incomplete int
+		forbidden  int
+	}{{
+		title:      "in order",
+		events:     []string{"create test-user", "get other-user", "update test-user", "delete test-user"},
+		assertions: AuditAssertions{Sequences: []AuditSequence{{Events: sequence}}},
+	}, {
+		title:      "out of order",
+		events:     []string{"update test-user", "create test-user", "delete test-user"},
+		assertions: AuditAssertions{Sequences: []AuditSequence{{Events: sequence}}},
+		incomplete: 1,
+	}, {
+		title:      "interrupted contiguous sequence",
+		events:     []string{"create test-user", "get other-user", "update test-user", "delete test-user"},
+		assertions: AuditAssertions{Sequences: []AuditSequence{{Events: sequence, Scope: podEvents}}},
+		incomplete: 1,
+	}, {
+		title:      "contiguous sequence started over",
+		events:     []string{"create test-user", "get other-user", "create test-user", "update test-user", "delete test-user"},
+		assertions: AuditAssertions{Sequences: []AuditSequence{{Events: sequence, Scope: podEvents}}},
+	}, {
+		title:  "forbidden event",
+		events: []string{"create test-user", "get other-user"},
+		assertions: AuditAssertions{
+			Forbidden: []AuditExpectation{AuditEventMatcher{Verb: Equals("get"), User: Equals("other-user")}},
+		},
+		forbidden: 1,
+	}, {
+		title:  "forbidden event outside of the window",
+		events: []string{"get other-user", "create test-user", "update test-user", "delete test-user"},
+		assertions: AuditAssertions{
+			Sequences: []AuditSequence{{Events: sequence, Scope: podEvents}},
+			Forbidden: []AuditExpectation{AuditEventMatcher{Verb: Equals("get"), User: Equals("other-user")}},
+			Since:     start.Add(time.Second),
+		},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			report := CheckAuditListSequences(testEventList(start, test.events...), test.assertions)
+			if len(report.Incomplete()) != test.incomplete || len(report.ForbiddenEvents) != test.forbidden {
+				t.Errorf(
+					"expected %d incomplete sequences and %d forbidden events, got: %s",
+					test.incomplete,
+					test.forbidden,
+					report,
+				)
+			}
+		})
+	}
+}
+
+func TestAuditAssertionsReport(t *testing.T) {
+	start := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	report := CheckAuditListSequences(
+		testEventList(start, "create test-user", "patch other-user", "update test-user"),
+		AuditAssertions{Sequences: []AuditSequence{{
+			Events: []AuditExpectation{
+				AuditEventMatcher{Verb: Equals("create")},
+				AuditEventMatcher{Verb: Equals("update")},
+			},
+			Scope: AuditEventMatcher{Resource: Equals("pods")},
+		}}},
+	)
+
+	incomplete := report.Incomplete()
+	if len(incomplete) != 1 || incomplete[0].Matched != 1 || incomplete[0].Interruption.Verb != "patch" {
+		t.Fatalf("expected the sequence to be interrupted by the patch, got: %s", report)
+	}
+
+	for _, expected := range []string{
+		`1 of 2 events found in order: {Verb="create"} -> {Verb="update"} (contiguous for {Resource="pods"})`,
+		"interrupted by: Request ResponseComplete patch",
+	} {
+		if !strings.Contains(report.String(), expected) {
+			t.Errorf("not found in the report: %q\n%s", expected, report)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+// Count is the number of requests of a key, like a user or a verb.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// ResourceVerbs counts the requests of a resource by verb.
+type ResourceVerbs struct {
+	Resource string  `json:"resource"`
+	Count    int     `json:"count"`
+	Verbs    []Count `json:"verbs"`
+}
+
+// AuditRequest is a request of the audit log.
+type AuditRequest struct {
+	AuditID    string        `json:"auditID"`
+	User       string        `json:"user"`
+	Verb       string        `json:"verb"`
+	RequestURI string        `json:"requestURI"`
+	Code       int32         `json:"code"`
+	Received   time.Time     `json:"received"`
+	Duration   time.Duration `json:"duration"`
+	Reason     string        `json:"reason,omitempty"`
+}
+
+// Impersonation counts the requests of a user impersonating another one.
+type Impersonation struct {
+	User               string `json:"user"`
+	ImpersonatedUser   string `json:"impersonatedUser"`
+	ImpersonatedGroups string `json:"impersonatedGroups,omitempty"`
+	Count              int    `json:"count"`
+}
+
+// AuditStats aggregates the requests of an audit log. A request is counted
+// once, with its final event, at the ResponseComplete or Panic stage.
+type AuditStats struct {
+	NumEvents   int       `json:"numEvents"`
+	NumRequests int       `json:"numRequests"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+
+	Users     []Count         `json:"users"`
+	Resources []ResourceVerbs `json:"resources"`
+
+	// Denied are the requests forbidden by the authorizers.
+	NumDenied int            `json:"numDenied"`
+	Denied    []AuditRequest `json:"denied"`
+
+	// Slowest are the slowest requests, without the watches, which last
+	// until they are closed.
+	Slowest []AuditRequest `json:"slowest"`
+
+	Impersonations []Impersonation `json:"impersonations"`
+}
+
+// nonResourceKey is the resource of the requests to non-resource paths.
+const nonResourceKey = "(non-resource)"
+
+// auditStatsBuilder aggregates the events of an audit log.
+type auditStatsBuilder struct {
+	top            int
+	stats          AuditStats
+	users          map[string]int
+	resources      map[string]map[string]int
+	impersonations map[Impersonation]int
+	denied         []AuditRequest
+	requests       []AuditRequest
+}
+
+func newAuditStatsBuilder(top int) *auditStatsBuilder {
+	return &auditStatsBuilder{
+		top:            top,
+		users:          make(map[string]int),
+		resources:      make(map[string]map[string]int),
+		impersonations: make(map[Impersonation]int),
+	}
+}
+
+// resourceKey returns the group, the resource and the subresource of the
+// request, like apps/deployments/scale.
+func resourceKey(e *auditinternal.Event) string {
+	ref := e.ObjectRef
+	if ref == nil || ref.Resource == "" {
+		return nonResourceKey
+	}
+
+	key := ref.Resource
+	if ref.APIGroup != "" {
+		key = ref.APIGroup + "/" + key
+	}
+
+	if ref.Subresource != "" {
+		key += "/" + ref.Subresource
+	}
+
+	return key
+}
+
+func (b *auditStatsBuilder) add(e *auditinternal.Event) {
+	b.stats.NumEvents++
+	received := e.RequestReceivedTimestamp.Time
+	if b.stats.First.IsZero() || received.Before(b.stats.First) {
+		b.stats.First = received
+	}
+
+	if received.After(b.stats.Last) {
+		b.stats.Last = received
+	}
+
+	if e.Stage != auditinternal.StageResponseComplete && e.Stage != auditinternal.StagePanic {
+		return
+	}
+
+	event, err := testEventFromInternal(e)
+	if err != nil {
+		return
+	}
+
+	b.stats.NumRequests++
+	b.users[event.User]++
+
+	resource := resourceKey(e)
+	if b.resources[resource] == nil {
+		b.resources[resource] = make(map[string]int)
+	}
+	b.resources[resource][event.Verb]++
+
+	if event.ImpersonatedUser != "" {
+		b.impersonations[Impersonation{
+			User:               event.User,
+			ImpersonatedUser:   event.ImpersonatedUser,
+			ImpersonatedGroups: event.ImpersonatedGroups,
+		}]++
+	}
+
+	request := AuditRequest{
+		AuditID:    string(e.AuditID),
+		User:       event.User,
+		Verb:       event.Verb,
+		RequestURI: event.RequestURI,
+		Code:       event.Code,
+		Received:   received,
+		Duration:   e.StageTimestamp.Time.Sub(received),
+		Reason:     e.Annotations["authorization.k8s.io/reason"],
+	}
+
+	if event.AuthorizeDecision == "forbid" || event.Code == 403 {
+		b.stats.NumDenied++
+		b.denied = append(b.denied, request)
+	}
+
+	if event.Verb != "watch" {
+		b.requests = append(b.requests, request)
+	}
+}
+
+// topCounts returns the counts sorted by count and name, limited to top
+// entries unless top is zero.
+func topCounts(counts map[string]int, top int) []Count {
+	result := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, Count{Name: name, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	if top > 0 && len(result) > top {
+		result = result[:top]
+	}
+
+	return result
+}
+
+func (b *auditStatsBuilder) finish() *AuditStats {
+	stats := b.stats
+	stats.Users = topCounts(b.users, b.top)
+
+	resources := make(map[string]int)
+	for resource, verbs := range b.resources {
+		for _, count := range verbs {
+			resources[resource] += count
+		}
+	}
+
+	for _, resource := range topCounts(resources, b.top) {
+		stats.Resources = append(stats.Resources, ResourceVerbs{
+			Resource: resource.Name,
+			Count:    resource.Count,
+			Verbs:    topCounts(b.resources[resource.Name], 0),
+		})
+	}
+
+	stats.Denied = b.denied
+	if b.top > 0 && len(stats.Denied) > b.top {
+		stats.Denied = stats.Denied[:b.top]
+	}
+
+	sort.SliceStable(b.requests, func(i, j int) bool {
+		return b.requests[i].Duration > b.requests[j].Duration
+	})
+
+	stats.Slowest = b.requests
+	if b.top > 0 && len(stats.Slowest) > b.top {
+		stats.Slowest = stats.Slowest[:b.top]
+	}
+
+	for i, count := range b.impersonations {
+		i.Count = count
+		stats.Impersonations = append(stats.Impersonations, i)
+	}
+
+	sort.Slice(stats.Impersonations, func(i, j int) bool {
+		x, y := stats.Impersonations[i], stats.Impersonations[j]
+		switch {
+		case x.Count != y.Count:
+			return x.Count > y.Count
+		case x.User != y.User:
+			return x.User < y.User
+		case x.ImpersonatedUser != y.ImpersonatedUser:
+			return x.ImpersonatedUser < y.ImpersonatedUser
+		default:
+			return x.ImpersonatedGroups < y.ImpersonatedGroups
+		}
+	})
+
+	return &stats
+}
+
+// AnalyzeAuditLog aggregates the requests of an audit log. The lists of the
+// stats are limited to top entries, unless top is zero.
+func AnalyzeAuditLog(stream io.Reader, version schema.GroupVersion, top int) (*AuditStats, error) {
+	builder := newAuditStatsBuilder(top)
+	if _, err := scanAuditLines(stream, version, builder.add); err != nil {
+		return nil, err
+	}
+
+	return builder.finish(), nil
+}
+
+// WriteText writes the stats as human readable tables.
+func (s *AuditStats) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	section := func(title string) {
+		fmt.Fprintf(tw, "\n%s\n", title)
+	}
+
+	fmt.Fprintf(
+		tw,
+		"%d events, %d requests from %s to %s\n",
+		s.NumEvents,
+		s.NumRequests,
+		s.First.Format(time.RFC3339),
+		s.Last.Format(time.RFC3339),
+	)
+
+	section("Top users:")
+	for _, u := range s.Users {
+		fmt.Fprintf(tw, "  %d\t%s\n", u.Count, u.Name)
+	}
+
+	section("Verbs per resource:")
+	for _, r := range s.Resources {
+		verbs := make([]string, 0, len(r.Verbs))
+		for _, v := range r.Verbs {
+			verbs = append(verbs, fmt.Sprintf("%s=%d", v.Name, v.Count))
+		}
+
+		fmt.Fprintf(tw, "  %d\t%s\t%s\n", r.Count, r.Resource, strings.Join(verbs, " "))
+	}
+
+	section(fmt.Sprintf("Denied requests (%d):", s.NumDenied))
+	for _, r := range s.Denied {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%d\t%s\n", r.User, r.Verb, r.RequestURI, r.Code, r.Reason)
+	}
+
+	section("Slowest requests:")
+	for _, r := range s.Slowest {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%d\n", r.Duration, r.User, r.Verb, r.RequestURI, r.Code)
+	}
+
+	section("Impersonation:")
+	for _, i := range s.Impersonations {
+		fmt.Fprintf(tw, "  %d\t%s\tas %s\t%s\n", i.Count, i.User, i.ImpersonatedUser, i.ImpersonatedGroups)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+func TestAnalyzeAuditLog(t *testing.T) {
+	start := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	var lines []string
+	add := func(offset, duration time.Duration, modify func(e *auditinternal.Event)) {
+		e := testAuditEvent()
+		e.ImpersonatedUser = nil
+		e.RequestReceivedTimestamp = metav1.NewMicroTime(start.Add(offset))
+		e.StageTimestamp = metav1.NewMicroTime(start.Add(offset + duration))
+		modify(&e)
+		lines = append(lines, testAuditLine(t, e))
+	}
+
+	add(0, 2*time.Second, func(e *auditinternal.Event) {
+		e.ImpersonatedUser = testAuditEvent().ImpersonatedUser
+	})
+	add(time.Second, 0, func(e *auditinternal.Event) {
+		e.Stage = auditinternal.StageRequestReceived
+		e.Verb = "get"
+	})
+	add(time.Second, time.Second/2, func(e *auditinternal.Event) {
+		e.Verb = "get"
+		e.ResponseStatus.Code = 403
+		e.Annotations = map[string]string{
+			"authorization.k8s.io/decision": "forbid",
+			"authorization.k8s.io/reason":   "no RBAC policy matched",
+		}
+	})
+	add(2*time.Second, 100*time.Second, func(e *auditinternal.Event) {
+		e.Verb = "watch"
+		e.User.Username = "kubelet"
+	})
+	add(3*time.Second, time.Second, func(e *auditinternal.Event) {
+		e.Verb = "create"
+		e.User.Username = "other-user"
+		e.ObjectRef = &auditinternal.ObjectReference{APIGroup: "apps", Resource: "deployments", Namespace: "teapot"}
+	})
+
+	stats, err := AnalyzeAuditLog(strings.NewReader(strings.Join(lines, "\n")), auditv1.SchemeGroupVersion, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.NumEvents != 5 || stats.NumRequests != 4 {
+		t.Errorf("expected 4 requests in 5 events, got %d in %d", stats.NumRequests, stats.NumEvents)
+	}
+
+	if !stats.First.Equal(start) || !stats.Last.Equal(start.Add(3*time.Second)) {
+		t.Errorf("unexpected time range %s - %s", stats.First, stats.Last)
+	}
+
+	if expected := []Count{{"test-user", 2}, {"kubelet", 1}}; !reflect.DeepEqual(stats.Users, expected) {
+		t.Errorf("expected top users %v, got %v", expected, stats.Users)
+	}
+
+	expectedResources := []ResourceVerbs{
+		{Resource: "pods", Count: 3, Verbs: []Count{{"get", 1}, {"patch", 1}, {"watch", 1}}},
+		{Resource: "apps/deployments", Count: 1, Verbs: []Count{{"create", 1}}},
+	}
+	if !reflect.DeepEqual(stats.Resources, expectedResources) {
+		t.Errorf("expected resources %v, got %v", expectedResources, stats.Resources)
+	}
+
+	if stats.NumDenied != 1 || stats.Denied[0].Verb != "get" || stats.Denied[0].Reason != "no RBAC policy matched" {
+		t.Errorf("expected the get request denied, got %v", stats.Denied)
+	}
+
+	if len(stats.Slowest) != 2 || stats.Slowest[0].Verb != "patch" || stats.Slowest[0].Duration != 2*time.Second {
+		t.Errorf("expected the patch request to be the slowest, without the watch, got %v", stats.Slowest)
+	}
+
+	expectedImpersonations := []Impersonation{{User: "test-user", ImpersonatedUser: "other-user", ImpersonatedGroups: "ReadOnly", Count: 1}}
+	if !reflect.DeepEqual(stats.Impersonations, expectedImpersonations) {
+		t.Errorf("expected impersonations %v, got %v", expectedImpersonations, stats.Impersonations)
+	}
+
+	var text bytes.Buffer
+	if err := stats.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"5 events, 4 requests", "Denied requests (1):", "as other-user"} {
+		if !strings.Contains(text.String(), expected) {
+			t.Errorf("not found in the text output: %q\n%s", expected, text.String())
+		}
+	}
+}
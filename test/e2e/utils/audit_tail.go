@@ -0,0 +1,338 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+// auditLogHeadSize is the size of the beginning of the log compared to
+// detect rotations.
+const auditLogHeadSize = 512
+
+// AuditLogTailer reads an audit log served over HTTP incrementally, like the
+// /logs/kube-audit.log endpoint of the API server. Every poll only requests
+// the part of the log appended since the previous one, with a range request.
+// A rotated log is detected when it gets shorter or its beginning changes,
+// and then it's read from the start. The events written to the old log
+// after the last poll are lost.
+type AuditLogTailer struct {
+	client  *http.Client
+	url     string
+	version schema.GroupVersion
+
+	offset int64
+
+	// head is the beginning of the log, to detect rotations
+	head []byte
+
+	// partial is the incomplete last line of the previous poll
+	partial []byte
+
+	// resync drops the data up to the next line, because the offset is not
+	// at the start of a line
+	resync bool
+
+	// Rotations is the number of log rotations detected.
+	Rotations int
+}
+
+// NewAuditLogTailer creates a tailer for the audit log at url, which reads it
+// from the start.
+func NewAuditLogTailer(client *http.Client, url string, version schema.GroupVersion) *AuditLogTailer {
+	return &AuditLogTailer{client: client, url: url, version: version}
+}
+
+func (t *AuditLogTailer) get(ctx context.Context, method, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequest(method, t.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if byteRange != "" {
+		req.Header.Set("Range", "bytes="+byteRange)
+	}
+
+	return t.client.Do(req.WithContext(ctx))
+}
+
+// readHead returns the beginning of the log and the size of the whole log.
+// The API server only serves the log with GET, so the size is read from the
+// Content-Range of the range request instead of a HEAD request.
+func (t *AuditLogTailer) readHead(ctx context.Context) ([]byte, int64, error) {
+	rsp, err := t.get(ctx, http.MethodGet, fmt.Sprintf("0-%d", auditLogHeadSize-1))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusPartialContent:
+		size, err := rangeSize(rsp)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		head, err := ioutil.ReadAll(rsp.Body)
+		if len(head) > auditLogHeadSize {
+			head = head[:auditLogHeadSize]
+		}
+
+		return head, size, err
+	case http.StatusOK:
+		// the range was ignored, so the whole log is returned
+		data, err := ioutil.ReadAll(rsp.Body)
+		head := data
+		if len(head) > auditLogHeadSize {
+			head = head[:auditLogHeadSize]
+		}
+
+		return head, int64(len(data)), err
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the log is empty
+		return nil, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("failed to read the audit log head: %s", rsp.Status)
+	}
+}
+
+// rotated tells whether the log was replaced since the last poll.
+func (t *AuditLogTailer) rotated(ctx context.Context) (bool, error) {
+	head, _, err := t.readHead(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if len(head) < len(t.head) || !bytes.Equal(head[:len(t.head)], t.head) {
+		return true, nil
+	}
+
+	// the head of a short log grows with it
+	t.head = head
+	return false, nil
+}
+
+func (t *AuditLogTailer) reset() {
+	t.Rotations++
+	t.offset = 0
+	t.head = nil
+	t.partial = nil
+	t.resync = false
+}
+
+// rangeSize returns the size of the log from the Content-Range header of a
+// response to a range request.
+func rangeSize(rsp *http.Response) (int64, error) {
+	contentRange := rsp.Header.Get("Content-Range")
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+
+	return strconv.ParseInt(contentRange[i+1:], 10, 64)
+}
+
+// SeekToEnd skips the events currently in the log, so that the next poll
+// only returns the events written from now on.
+func (t *AuditLogTailer) SeekToEnd(ctx context.Context) error {
+	head, size, err := t.readHead(ctx)
+	if err != nil {
+		return err
+	}
+
+	t.head = head
+	t.partial = nil
+	t.offset = size
+
+	// the last byte is read again to find out if the offset is at the start
+	// of a line
+	if t.offset > 0 {
+		t.offset--
+		t.resync = true
+	}
+
+	return nil
+}
+
+// read returns the data appended to the log since the last poll.
+func (t *AuditLogTailer) read(ctx context.Context) ([]byte, error) {
+	if t.offset > 0 {
+		rotated, err := t.rotated(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if rotated {
+			t.reset()
+		}
+	}
+
+	rsp, err := t.get(ctx, http.MethodGet, fmt.Sprintf("%d-", t.offset))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rsp.Body.Close()
+	switch rsp.StatusCode {
+	case http.StatusPartialContent:
+		return ioutil.ReadAll(rsp.Body)
+	case http.StatusOK:
+		// the range was ignored, so the whole log is returned
+		data, err := ioutil.ReadAll(rsp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(len(data)) < t.offset {
+			t.reset()
+			return data, nil
+		}
+
+		return data[t.offset:], nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		size, err := rangeSize(rsp)
+		if err != nil {
+			return nil, err
+		}
+
+		if size < t.offset {
+			t.reset()
+			return t.read(ctx)
+		}
+
+		// nothing new
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("failed to read the audit log: %s", rsp.Status)
+	}
+}
+
+// Poll reads the events appended to the log since the last poll, and calls
+// f for every event. It returns the number of events.
+func (t *AuditLogTailer) Poll(ctx context.Context, f func(e *auditinternal.Event)) (int, error) {
+	data, err := t.read(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if t.offset == 0 && len(t.head) == 0 {
+		t.head = data
+		if len(t.head) > auditLogHeadSize {
+			t.head = t.head[:auditLogHeadSize]
+		}
+
+		t.head = append([]byte(nil), t.head...)
+	}
+
+	t.offset += int64(len(data))
+	if t.resync {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return 0, nil
+		}
+
+		data = data[i+1:]
+		t.resync = false
+	}
+
+	data = append(t.partial, data...)
+	last := bytes.LastIndexByte(data, '\n')
+	if last < 0 {
+		t.partial = data
+		return 0, nil
+	}
+
+	t.partial = append([]byte(nil), data[last+1:]...)
+
+	var n int
+	for _, line := range bytes.Split(data[:last], []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		e, err := decodeAuditLine(line, t.version)
+		if err != nil {
+			return n, err
+		}
+
+		f(e)
+		n++
+	}
+
+	return n, nil
+}
+
+// pollUntil polls the log every interval until done returns true, or the
+// context is done.
+func (t *AuditLogTailer) pollUntil(ctx context.Context, interval time.Duration, f func(e *auditinternal.Event), done func() bool) error {
+	for {
+		if _, err := t.Poll(ctx, f); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		if done() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// WaitForEvents polls the log every interval until all the expected events
+// are found, or the context is done. The events found stay found across the
+// polls. The observers are called for every event read.
+func (t *AuditLogTailer) WaitForEvents(ctx context.Context, expected []AuditExpectation, interval time.Duration, observers ...func(e *auditinternal.Event)) (*MissingEventsReport, error) {
+	expectations := newAuditEventTracker(expected)
+	report := &MissingEventsReport{MissingEvents: expected}
+	err := t.pollUntil(ctx, interval, func(e *auditinternal.Event) {
+		if report.FirstEventChecked == nil {
+			report.FirstEventChecked = e
+		}
+		report.LastEventChecked = e
+		report.NumEventsChecked++
+
+		expectations.Mark(e)
+		for _, observe := range observers {
+			observe(e)
+		}
+	}, func() bool {
+		report.MissingEvents, report.NearestCandidates = expectations.Missing()
+		return len(report.MissingEvents) == 0
+	})
+
+	return report, err
+}
+
+// WaitForAssertions polls the log every interval until all the sequences of
+// the assertions are complete, a forbidden event occurs, or the context is
+// done.
+func (t *AuditLogTailer) WaitForAssertions(ctx context.Context, assertions AuditAssertions, interval time.Duration) (*AuditAssertionsReport, error) {
+	checker := newAuditAssertionsChecker(assertions)
+	var report *AuditAssertionsReport
+	err := t.pollUntil(ctx, interval, checker.check, func() bool {
+		report = checker.finish()
+		return len(report.ForbiddenEvents) > 0 || len(report.Incomplete()) == 0
+	})
+
+	if report == nil {
+		report = checker.finish()
+	}
+
+	return report, err
+}
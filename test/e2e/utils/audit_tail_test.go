@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+// testAuditLog serves a growing audit log. Every request reading past the
+// head of the log appends the next pending line first.
+type testAuditLog struct {
+	mu          sync.Mutex
+	data        []byte
+	pending     []string
+	ignoreRange bool
+}
+
+func (l *testAuditLog) write(s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.data = append(l.data, s...)
+}
+
+func (l *testAuditLog) rotate(s string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.data = []byte(s)
+}
+
+func (l *testAuditLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// like the /logs endpoint of the API server
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	headRange := fmt.Sprintf("bytes=0-%d", auditLogHeadSize-1)
+	if r.Header.Get("Range") != headRange && len(l.pending) > 0 {
+		l.data = append(l.data, l.pending[0]...)
+		l.pending = l.pending[1:]
+	}
+
+	if l.ignoreRange {
+		w.Header().Set("Content-Length", strconv.Itoa(len(l.data)))
+		w.Write(l.data)
+		return
+	}
+
+	http.ServeContent(w, r, "kube-audit.log", time.Time{}, bytes.NewReader(l.data))
+}
+
+func testAuditLines(t *testing.T, verbs ...string) []string {
+	var lines []string
+	for _, verb := range verbs {
+		e := testAuditEvent()
+		e.Verb = verb
+		lines = append(lines, testAuditLine(t, e)+"\n")
+	}
+
+	return lines
+}
+
+func TestAuditLogTailer(t *testing.T) {
+	for _, ignoreRange := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ignore range %t", ignoreRange), func(t *testing.T) {
+			log := &testAuditLog{ignoreRange: ignoreRange}
+			server := httptest.NewServer(log)
+			defer server.Close()
+
+			lines := testAuditLines(t, "get", "list", "create", "update", "patch", "delete")
+			log.write(lines[0] + lines[1][:10])
+
+			ctx := context.Background()
+			tailer := NewAuditLogTailer(server.Client(), server.URL, auditv1.SchemeGroupVersion)
+			if err := tailer.SeekToEnd(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			var verbs []string
+			poll := func(expected ...string) {
+				t.Helper()
+				verbs = nil
+				if _, err := tailer.Poll(ctx, func(e *auditinternal.Event) {
+					verbs = append(verbs, e.Verb)
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				if fmt.Sprint(verbs) != fmt.Sprint(expected) {
+					t.Fatalf("expected events %v, got %v", expected, verbs)
+				}
+			}
+
+			// the line written in part before seeking is skipped
+			log.write(lines[1][10:] + lines[2] + lines[3][:10])
+			poll("create")
+			poll()
+			log.write(lines[3][10:])
+			poll("update")
+
+			log.rotate(lines[4])
+			poll("patch")
+			if tailer.Rotations != 1 {
+				t.Errorf("expected one rotation, got %d", tailer.Rotations)
+			}
+
+			// a longer log with a different beginning is rotated too
+			log.rotate(lines[5] + lines[0] + lines[0])
+			poll("delete", "get", "get")
+			if tailer.Rotations != 2 {
+				t.Errorf("expected 2 rotations, got %d", tailer.Rotations)
+			}
+		})
+	}
+}
+
+func TestAuditLogTailerWaitForEvents(t *testing.T) {
+	log := &testAuditLog{pending: testAuditLines(t, "create", "update", "patch", "delete")}
+	server := httptest.NewServer(log)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tailer := NewAuditLogTailer(server.Client(), server.URL, auditv1.SchemeGroupVersion)
+	report, err := tailer.WaitForEvents(ctx, []AuditExpectation{
+		AuditEventMatcher{Verb: Equals("create")},
+		AuditEventMatcher{Verb: Equals("patch")},
+	}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the polling stops once the events are found
+	if report.NumEventsChecked != 3 || len(report.MissingEvents) != 0 {
+		t.Errorf("expected all the events found in 3 events, got: %s", report)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assertions, err := tailer.WaitForAssertions(ctx, AuditAssertions{
+		Sequences: []AuditSequence{{Events: []AuditExpectation{
+			AuditEventMatcher{Verb: Equals("delete")},
+			AuditEventMatcher{Verb: Equals("get")},
+		}}},
+	}, time.Millisecond)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+
+	if incomplete := assertions.Incomplete(); len(incomplete) != 1 || incomplete[0].Matched != 1 {
+		t.Errorf("expected one event of the sequence found, got: %s", assertions)
+	}
+}
+
+func TestAuditLogTailerSeekToEnd(t *testing.T) {
+	for _, ignoreRange := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ignore range %t", ignoreRange), func(t *testing.T) {
+			log := &testAuditLog{ignoreRange: ignoreRange}
+			server := httptest.NewServer(log)
+			defer server.Close()
+
+			ctx := context.Background()
+			tailer := NewAuditLogTailer(server.Client(), server.URL, auditv1.SchemeGroupVersion)
+
+			// an empty log
+			if err := tailer.SeekToEnd(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			// a log longer than its head
+			lines := testAuditLines(t, "get", "list", "watch", "create", "delete")
+			log.write(lines[0] + lines[1] + lines[2] + lines[3])
+			if len(log.data) <= auditLogHeadSize {
+				t.Fatalf("expected a log longer than %d bytes, got %d", auditLogHeadSize, len(log.data))
+			}
+
+			if err := tailer.SeekToEnd(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			log.write(lines[4])
+			var verbs []string
+			if _, err := tailer.Poll(ctx, func(e *auditinternal.Event) {
+				verbs = append(verbs, e.Verb)
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if fmt.Sprint(verbs) != "[delete]" {
+				t.Errorf("expected only the event written after seeking, got %v", verbs)
+			}
+		})
+	}
+}
@@ -20,9 +20,9 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -60,103 +60,239 @@ type MissingEventsReport struct {
 	FirstEventChecked *auditinternal.Event
 	LastEventChecked  *auditinternal.Event
 	NumEventsChecked  int
-	MissingEvents     []AuditEvent
+	MissingEvents     []AuditExpectation
+
+	// NearestCandidates holds for every missing event the checked event
+	// with the fewest mismatching fields, if any.
+	NearestCandidates []Candidate
+}
+
+// Candidate is an event that almost matches an expectation.
+type Candidate struct {
+	Event      *auditinternal.Event
+	Mismatches []string
 }
 
 // String returns a human readable string representation of the report
 func (m *MissingEventsReport) String() string {
+	missing := make([]string, 0, len(m.MissingEvents))
+	for i, e := range m.MissingEvents {
+		nearest := "no event checked"
+		if i < len(m.NearestCandidates) && m.NearestCandidates[i].Event != nil {
+			c := m.NearestCandidates[i]
+			nearest = fmt.Sprintf("%s, mismatching %s", describeEvent(c.Event), strings.Join(c.Mismatches, ", "))
+		}
+
+		missing = append(missing, fmt.Sprintf("  - %s\n    nearest candidate: %s", e, nearest))
+	}
+
 	return fmt.Sprintf(`missing %d events
 
-- first event checked: %#v
+- first event checked: %s
 
-- last event checked: %#v
+- last event checked: %s
 
 - number of events checked: %d
 
-- missing events: %#v`, len(m.MissingEvents), m.FirstEventChecked, m.LastEventChecked, m.NumEventsChecked, m.MissingEvents)
+- missing events:
+%s`, len(m.MissingEvents), describeEvent(m.FirstEventChecked), describeEvent(m.LastEventChecked), m.NumEventsChecked, strings.Join(missing, "\n"))
 }
 
 // CheckAuditLines searches the audit log for the expected audit lines.
-func CheckAuditLines(stream io.Reader, expected []AuditEvent, version schema.GroupVersion) (missingReport *MissingEventsReport, err error) {
+func CheckAuditLines(stream io.Reader, expected []AuditExpectation, version schema.GroupVersion) (missingReport *MissingEventsReport, err error) {
 	expectations := newAuditEventTracker(expected)
 
-	scanner := bufio.NewScanner(stream)
-
-	buf := make([]byte, 10487560)
-	scanner.Buffer(buf, cap(buf))
-
 	missingReport = &MissingEventsReport{
 		MissingEvents: expected,
 	}
 
-	var i int
-	for i = 0; scanner.Scan(); i++ {
-		line := scanner.Text()
-
-		e := &auditinternal.Event{}
-		decoder := audit.Codecs.UniversalDecoder(version)
-		if err := runtime.DecodeInto(decoder, []byte(line), e); err != nil {
-			return missingReport, fmt.Errorf("failed decoding buf: %s, apiVersion: %s", line, version)
-		}
-		if i == 0 {
+	i, err := scanAuditLines(stream, version, func(e *auditinternal.Event) {
+		if missingReport.FirstEventChecked == nil {
 			missingReport.FirstEventChecked = e
 		}
 		missingReport.LastEventChecked = e
 
-		event, err := testEventFromInternal(e)
+		expectations.Mark(e)
+	})
+	if err != nil {
+		return missingReport, err
+	}
+
+	missingReport.MissingEvents, missingReport.NearestCandidates = expectations.Missing()
+	missingReport.NumEventsChecked = i
+	return missingReport, nil
+}
+
+// scanAuditLines decodes the events of an audit log and calls f for every
+// event. It returns the number of events.
+func scanAuditLines(stream io.Reader, version schema.GroupVersion, f func(e *auditinternal.Event)) (int, error) {
+	scanner := bufio.NewScanner(stream)
+
+	buf := make([]byte, 10487560)
+	scanner.Buffer(buf, cap(buf))
+
+	var i int
+	for i = 0; scanner.Scan(); i++ {
+		e, err := decodeAuditLine(scanner.Bytes(), version)
 		if err != nil {
-			return missingReport, err
+			return i, err
 		}
 
-		expectations.Mark(event)
+		f(e)
 	}
-	if err := scanner.Err(); err != nil {
-		return missingReport, err
+
+	return i, scanner.Err()
+}
+
+// decodeAuditLine decodes a line of an audit log.
+func decodeAuditLine(line []byte, version schema.GroupVersion) (*auditinternal.Event, error) {
+	e := &auditinternal.Event{}
+	decoder := audit.Codecs.UniversalDecoder(version)
+	if err := runtime.DecodeInto(decoder, line, e); err != nil {
+		return nil, fmt.Errorf("failed decoding buf: %s, apiVersion: %s", line, version)
 	}
 
-	missingReport.MissingEvents = expectations.Missing()
-	missingReport.NumEventsChecked = i
-	return missingReport, nil
+	return e, nil
 }
 
 // CheckAuditList searches an audit event list for the expected audit events.
-func CheckAuditList(el auditinternal.EventList, expected []AuditEvent) (missing []AuditEvent, err error) {
+func CheckAuditList(el auditinternal.EventList, expected []AuditExpectation) (missing []AuditExpectation, err error) {
 	expectations := newAuditEventTracker(expected)
 
-	for _, e := range el.Items {
-		event, err := testEventFromInternal(&e)
-		if err != nil {
-			return expected, err
-		}
+	for i := range el.Items {
+		expectations.Mark(&el.Items[i])
+	}
+
+	missing, _ = expectations.Missing()
+	return missing, nil
+}
+
+// DuplicateGroup is a set of identical audit events, with the same audit
+// ID.
+type DuplicateGroup struct {
+	// Event is the first occurrence.
+	Event *auditinternal.Event
+	Count int
+
+	// First and Last are the stage timestamps of the first and the last
+	// occurrences.
+	First time.Time
+	Last  time.Time
+}
+
+func (g DuplicateGroup) String() string {
+	return fmt.Sprintf(
+		"%d times between %s and %s: %s",
+		g.Count,
+		g.First.Format(time.RFC3339Nano),
+		g.Last.Format(time.RFC3339Nano),
+		describeEvent(g.Event),
+	)
+}
+
+// auditEventKey is the comparable form of the AuditEvent of an event,
+// including its ID, used to index the events. The annotation maps are
+// encoded as strings.
+type auditEventKey struct {
+	ID                                  types.UID
+	Level                               auditinternal.Level
+	Stage                               auditinternal.Stage
+	RequestURI                          string
+	Verb                                string
+	Code                                int32
+	User                                string
+	ImpersonatedUser                    string
+	ImpersonatedGroups                  string
+	Resource                            string
+	Namespace                           string
+	RequestObject                       bool
+	ResponseObject                      bool
+	AuthorizeDecision                   string
+	AdmissionWebhookMutationAnnotations string
+	AdmissionWebhookPatchAnnotations    string
+}
+
+// canonicalAnnotations returns the annotations as a string, sorted by key.
+func canonicalAnnotations(annotations map[string]string) string {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
 
-		expectations.Mark(event)
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%q=%q,", k, annotations[k])
 	}
 
-	return expectations.Missing(), nil
+	return b.String()
 }
 
-// CheckForDuplicates checks a list for duplicate events
-func CheckForDuplicates(el auditinternal.EventList) (auditinternal.EventList, error) {
-	// existingEvents holds a slice of audit events that have been seen
-	existingEvents := []AuditEvent{}
-	duplicates := auditinternal.EventList{}
-	var err error
-	for _, e := range el.Items {
-		event, err := testEventFromInternal(&e)
+func newAuditEventKey(e *auditinternal.Event) (auditEventKey, error) {
+	event, err := testEventFromInternal(e)
+	if err != nil {
+		return auditEventKey{}, err
+	}
+
+	return auditEventKey{
+		ID:                                  e.AuditID,
+		Level:                               event.Level,
+		Stage:                               event.Stage,
+		RequestURI:                          event.RequestURI,
+		Verb:                                event.Verb,
+		Code:                                event.Code,
+		User:                                event.User,
+		ImpersonatedUser:                    event.ImpersonatedUser,
+		ImpersonatedGroups:                  event.ImpersonatedGroups,
+		Resource:                            event.Resource,
+		Namespace:                           event.Namespace,
+		RequestObject:                       event.RequestObject,
+		ResponseObject:                      event.ResponseObject,
+		AuthorizeDecision:                   event.AuthorizeDecision,
+		AdmissionWebhookMutationAnnotations: canonicalAnnotations(event.AdmissionWebhookMutationAnnotations),
+		AdmissionWebhookPatchAnnotations:    canonicalAnnotations(event.AdmissionWebhookPatchAnnotations),
+	}, nil
+}
+
+// CheckForDuplicates checks a list for duplicate events. It returns the
+// groups of duplicates, in the order of their first occurrence, and an error
+// when there are any.
+func CheckForDuplicates(el auditinternal.EventList) ([]DuplicateGroup, error) {
+	// groups indexes the events seen by their key
+	groups := make(map[auditEventKey]int)
+	var seen []DuplicateGroup
+	for i := range el.Items {
+		e := &el.Items[i]
+		key, err := newAuditEventKey(e)
 		if err != nil {
-			return duplicates, err
+			return nil, err
 		}
-		event.ID = e.AuditID
-		for _, existing := range existingEvents {
-			if reflect.DeepEqual(existing, event) {
-				duplicates.Items = append(duplicates.Items, e)
-				err = fmt.Errorf("failed duplicate check")
-				continue
-			}
+
+		timestamp := e.StageTimestamp.Time
+		if g, ok := groups[key]; ok {
+			seen[g].Count++
+			seen[g].Last = timestamp
+			continue
+		}
+
+		groups[key] = len(seen)
+		seen = append(seen, DuplicateGroup{Event: e, Count: 1, First: timestamp, Last: timestamp})
+	}
+
+	var duplicates []DuplicateGroup
+	var count int
+	for _, g := range seen {
+		if g.Count > 1 {
+			duplicates = append(duplicates, g)
+			count += g.Count - 1
 		}
-		existingEvents = append(existingEvents, event)
 	}
-	return duplicates, err
+
+	if len(duplicates) > 0 {
+		return duplicates, fmt.Errorf("failed duplicate check: %d duplicate events in %d groups", count, len(duplicates))
+	}
+
+	return nil, nil
 }
 
 // testEventFromInternal takes an internal audit event and returns a test event
@@ -203,19 +339,20 @@ func testEventFromInternal(e *auditinternal.Event) (AuditEvent, error) {
 	return event, nil
 }
 
-// auditEvent is a private wrapper on top of AuditEvent used by auditEventTracker
+// auditEvent is a private wrapper on top of AuditExpectation used by auditEventTracker
 type auditEvent struct {
-	event AuditEvent
-	found bool
+	event   AuditExpectation
+	found   bool
+	nearest Candidate
 }
 
-// auditEventTracker keeps track of AuditEvent expectations and marks matching events as found
+// auditEventTracker keeps track of AuditExpectations and marks matching events as found
 type auditEventTracker struct {
 	events []*auditEvent
 }
 
 // newAuditEventTracker creates a tracker that tracks whether expect events are found
-func newAuditEventTracker(expected []AuditEvent) *auditEventTracker {
+func newAuditEventTracker(expected []AuditExpectation) *auditEventTracker {
 	expectations := &auditEventTracker{events: []*auditEvent{}}
 	for _, event := range expected {
 		// we copy the references to the maps in event
@@ -224,25 +361,36 @@ func newAuditEventTracker(expected []AuditEvent) *auditEventTracker {
 	return expectations
 }
 
-// Mark marks the given event as found if it's expected
-func (t *auditEventTracker) Mark(event AuditEvent) {
-	// reset Annotation maps as we don't want to compare those
-	event.AdmissionWebhookMutationAnnotations = nil
-	event.AdmissionWebhookPatchAnnotations = nil
+// Mark marks the expectations matching the given event as found, and keeps
+// track of the nearest candidate of the others
+func (t *auditEventTracker) Mark(event *auditinternal.Event) {
 	for _, e := range t.events {
-		if reflect.DeepEqual(e.event, event) {
+		if e.found {
+			continue
+		}
+
+		mismatches := e.event.Mismatches(event)
+		if len(mismatches) == 0 {
 			e.found = true
+		} else if e.nearest.Event == nil || len(mismatches) < len(e.nearest.Mismatches) {
+			e.nearest = Candidate{Event: event, Mismatches: mismatches}
 		}
 	}
 }
 
-// Missing reports events that are expected but not found
-func (t *auditEventTracker) Missing() []AuditEvent {
-	var missing []AuditEvent
+// Missing reports events that are expected but not found, with their nearest
+// candidates
+func (t *auditEventTracker) Missing() ([]AuditExpectation, []Candidate) {
+	var (
+		missing    []AuditExpectation
+		candidates []Candidate
+	)
+
 	for _, e := range t.events {
 		if !e.found {
 			missing = append(missing, e.event)
+			candidates = append(candidates, e.nearest)
 		}
 	}
-	return missing
+	return missing, candidates
 }
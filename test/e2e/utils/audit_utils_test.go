@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/mutating"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+)
+
+// testDuplicateEvents returns an event for every ID, logged a second apart.
+func testDuplicateEvents(start time.Time, ids ...string) auditinternal.EventList {
+	var el auditinternal.EventList
+	for i, id := range ids {
+		e := testAuditEvent()
+		e.AuditID = types.UID(id)
+		e.StageTimestamp = metav1.NewMicroTime(start.Add(time.Duration(i) * time.Second))
+		el.Items = append(el.Items, e)
+	}
+
+	return el
+}
+
+func TestCheckForDuplicates(t *testing.T) {
+	start := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		title  string
+		events auditinternal.EventList
+		groups []DuplicateGroup
+	}{{
+		title: "empty",
+	}, {
+		title:  "no duplicates",
+		events: testDuplicateEvents(start, "a", "b", "c"),
+	}, {
+		title:  "duplicates",
+		events: testDuplicateEvents(start, "a", "b", "a", "c", "b", "a"),
+		groups: []DuplicateGroup{
+			{Count: 3, First: start, Last: start.Add(5 * time.Second)},
+			{Count: 2, First: start.Add(time.Second), Last: start.Add(4 * time.Second)},
+		},
+	}, {
+		title: "different stages",
+		events: func() auditinternal.EventList {
+			el := testDuplicateEvents(start, "a", "a")
+			el.Items[0].Stage = auditinternal.StageRequestReceived
+			return el
+		}(),
+	}, {
+		title: "different mutation annotations",
+		events: func() auditinternal.EventList {
+			el := testDuplicateEvents(start, "a", "a", "a")
+			el.Items[1].Annotations = map[string]string{mutating.MutationAuditAnnotationPrefix + "round_0_index_0": "{}"}
+			return el
+		}(),
+		groups: []DuplicateGroup{
+			{Count: 2, First: start, Last: start.Add(2 * time.Second)},
+		},
+	}} {
+		t.Run(test.title, func(t *testing.T) {
+			groups, err := CheckForDuplicates(test.events)
+			if (err != nil) != (len(test.groups) > 0) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if len(groups) != len(test.groups) {
+				t.Fatalf("expected %d duplicate groups, got %v", len(test.groups), groups)
+			}
+
+			for i, g := range groups {
+				expected := test.groups[i]
+				if g.Count != expected.Count || !g.First.Equal(expected.First) || !g.Last.Equal(expected.Last) {
+					t.Errorf("expected group %d to be %d times between %s and %s, got %s", i, expected.Count, expected.First, expected.Last, g)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCheckForDuplicates(b *testing.B) {
+	start := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	// 100000 events, every hundredth delivered twice
+	var ids []string
+	for i := 0; i < 100000; i++ {
+		ids = append(ids, fmt.Sprintf("event-%d", i))
+		if i%100 == 0 {
+			ids = append(ids, fmt.Sprintf("event-%d", i))
+		}
+	}
+
+	el := testDuplicateEvents(start, ids...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		groups, _ := CheckForDuplicates(el)
+		if len(groups) != 1000 {
+			b.Fatalf("expected 1000 duplicate groups, got %d", len(groups))
+		}
+	}
+}
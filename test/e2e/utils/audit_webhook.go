@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/audit"
+)
+
+// AuditWebhookReceiver is an in-process stand-in for the audit webhook, like
+// the audittrail-adapter, to be served with httptest in the tests of the
+// webhook path. It accepts the EventList batches sent by the webhook backend
+// of the API server, and keeps the received events.
+type AuditWebhookReceiver struct {
+	version schema.GroupVersion
+
+	mu       sync.Mutex
+	batches  []int
+	events   auditinternal.EventList
+	failures int
+}
+
+// NewAuditWebhookReceiver creates a receiver of audit events of the version,
+// usually audit.k8s.io/v1.
+func NewAuditWebhookReceiver(version schema.GroupVersion) *AuditWebhookReceiver {
+	return &AuditWebhookReceiver{version: version}
+}
+
+// FailRequests makes the receiver reject the next n batches with a server
+// error, to make the API server deliver them again.
+func (r *AuditWebhookReceiver) FailRequests(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = n
+}
+
+// DecodeAuditEventList decodes an EventList of the version.
+func DecodeAuditEventList(data []byte, version schema.GroupVersion) (auditinternal.EventList, error) {
+	var el auditinternal.EventList
+	decoder := audit.Codecs.UniversalDecoder(version)
+	if err := runtime.DecodeInto(decoder, data, &el); err != nil {
+		return el, fmt.Errorf("failed to decode the audit event list, apiVersion: %s: %v", version, err)
+	}
+
+	return el, nil
+}
+
+// EncodeAuditEventList encodes an EventList in the version.
+func EncodeAuditEventList(el *auditinternal.EventList, version schema.GroupVersion) ([]byte, error) {
+	return runtime.Encode(audit.Codecs.LegacyCodec(version), el)
+}
+
+func (r *AuditWebhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if contentType := req.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		http.Error(w, fmt.Sprintf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	el, err := DecodeAuditEventList(data, r.version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		http.Error(w, "failing on purpose", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.batches = append(r.batches, len(el.Items))
+	r.events.Items = append(r.events.Items, el.Items...)
+}
+
+// Batches returns the number of events of every batch received.
+func (r *AuditWebhookReceiver) Batches() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.batches...)
+}
+
+// Events returns all the events received, in the order of receipt.
+func (r *AuditWebhookReceiver) Events() *auditinternal.EventList {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &auditinternal.EventList{
+		Items: append([]auditinternal.Event(nil), r.events.Items...),
+	}
+}
+
+// AuditWebhookReport provides the outcome of checking the events received
+// by the webhook.
+type AuditWebhookReport struct {
+	Batches       []int
+	NumEvents     int
+	MissingEvents []AuditExpectation
+	Duplicates    []DuplicateGroup
+}
+
+// String returns a human readable string representation of the report
+func (r *AuditWebhookReport) String() string {
+	problems := []string{fmt.Sprintf("%d events received in %d batches %v", r.NumEvents, len(r.Batches), r.Batches)}
+	for _, e := range r.MissingEvents {
+		problems = append(problems, fmt.Sprintf("- missing event %s", e))
+	}
+
+	for _, g := range r.Duplicates {
+		problems = append(problems, fmt.Sprintf("- duplicate event %s", g))
+	}
+
+	return strings.Join(problems, "\n")
+}
+
+// Check checks the events received for the expected events and for
+// duplicates. The error reports duplicates.
+func (r *AuditWebhookReceiver) Check(expected []AuditExpectation) (*AuditWebhookReport, error) {
+	el := r.Events()
+	report := &AuditWebhookReport{
+		Batches:   r.Batches(),
+		NumEvents: len(el.Items),
+	}
+
+	missing, err := CheckAuditList(*el, expected)
+	if err != nil {
+		return report, err
+	}
+
+	report.MissingEvents = missing
+	report.Duplicates, err = CheckForDuplicates(*el)
+	return report, err
+}
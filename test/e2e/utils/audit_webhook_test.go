@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/plugin/pkg/audit/buffered"
+	"k8s.io/apiserver/plugin/pkg/audit/webhook"
+)
+
+// newTestAuditWebhookBackend returns the webhook backend of the API server,
+// batching the events like with --audit-webhook-mode=batch, which sends them
+// to the URL.
+func newTestAuditWebhookBackend(t *testing.T, url string, maxBatchSize int) audit.Backend {
+	kubeConfig, err := ioutil.TempFile("", "audit-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.Remove(kubeConfig.Name())
+	defer kubeConfig.Close()
+
+	_, err = fmt.Fprintf(kubeConfig, `apiVersion: v1
+kind: Config
+clusters:
+- name: receiver
+  cluster:
+    server: %s
+contexts:
+- name: receiver
+  context:
+    cluster: receiver
+current-context: receiver
+`, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed batches are sent again after 10ms, 15ms, ...
+	backend, err := webhook.NewBackend(kubeConfig.Name(), auditv1.SchemeGroupVersion, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the batches are only cut by their size
+	return buffered.NewBackend(backend, buffered.BatchConfig{
+		BufferSize:   100,
+		MaxBatchSize: maxBatchSize,
+		MaxBatchWait: time.Hour,
+	})
+}
+
+func TestAuditWebhookReceiver(t *testing.T) {
+	receiver := NewAuditWebhookReceiver(auditv1.SchemeGroupVersion)
+
+	// the response of the second batch accepted is lost, so the backend
+	// delivers it once more
+	var (
+		mu       sync.Mutex
+		accepted int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rsp := httptest.NewRecorder()
+		receiver.ServeHTTP(rsp, req)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if rsp.Code == http.StatusOK {
+			accepted++
+			if accepted == 2 {
+				http.Error(w, "response lost", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		w.WriteHeader(rsp.Code)
+		w.Write(rsp.Body.Bytes())
+	}))
+	defer server.Close()
+
+	backend := newTestAuditWebhookBackend(t, server.URL, 2)
+	stop := make(chan struct{})
+	if err := backend.Run(stop); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first batch is rejected and delivered again
+	receiver.FailRequests(1)
+
+	var events []*auditinternal.Event
+	for _, verb := range []string{"create", "update", "patch", "delete"} {
+		e := testAuditEvent()
+		e.Verb = verb
+		e.AuditID = types.UID(fmt.Sprintf("%s-id", verb))
+		events = append(events, &e)
+	}
+
+	backend.ProcessEvents(events...)
+
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		return len(receiver.Events().Items) >= 6, nil
+	})
+	close(stop)
+	backend.Shutdown()
+	if err != nil {
+		t.Fatalf("expected 6 events delivered, got %d: %v", len(receiver.Events().Items), err)
+	}
+
+	report, err := receiver.Check([]AuditExpectation{
+		AuditEventMatcher{Verb: Equals("create")},
+		AuditEventMatcher{Verb: Equals("delete")},
+		AuditEventMatcher{Verb: Equals("get")},
+	})
+	if err == nil {
+		t.Errorf("expected the duplicate check to fail")
+	}
+
+	if !reflect.DeepEqual(report.Batches, []int{2, 2, 2}) || report.NumEvents != 6 {
+		t.Errorf("expected 6 events in 3 batches, got: %s", report)
+	}
+
+	if len(report.MissingEvents) != 1 || report.MissingEvents[0].String() != `{Verb="get"}` {
+		t.Errorf("expected the get event missing, got: %s", report)
+	}
+
+	if len(report.Duplicates) != 2 || report.Duplicates[0].Count != 2 || report.Duplicates[0].Event.Verb != "patch" {
+		t.Errorf("expected the patch and the delete events twice, got: %s", report)
+	}
+
+	if events := receiver.Events(); len(events.Items) != 6 || events.Items[0].Verb != "create" || events.Items[5].Verb != "delete" {
+		t.Errorf("unexpected events received: %v", events.Items)
+	}
+}